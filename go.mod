@@ -11,6 +11,7 @@ require (
 	github.com/micromdm/plist v0.2.2
 	github.com/vbauerster/mpb/v8 v8.12.0
 	github.com/xo/ox v0.0.0-20250529002803-30865a99877b
+	golang.org/x/text v0.34.0
 )
 
 require (
@@ -27,5 +28,4 @@ require (
 	github.com/yookoala/realpath v1.0.0 // indirect
 	golang.org/x/sys v0.41.0 // indirect
 	golang.org/x/term v0.40.0 // indirect
-	golang.org/x/text v0.34.0 // indirect
 )
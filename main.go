@@ -3,11 +3,13 @@ package main
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
 	_ "embed"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,12 +19,15 @@ import (
 	"io"
 	"maps"
 	"math"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/user"
 	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
 	"slices"
@@ -30,8 +35,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"text/template"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/alitto/pond/v2"
 	"github.com/chromedp/verhist"
@@ -42,13 +50,22 @@ import (
 	"github.com/vbauerster/mpb/v8"
 	"github.com/vbauerster/mpb/v8/decor"
 	"github.com/xo/ox"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
 func main() {
 	args := &Args{
-		MacOSVersion: "v26.0",
-		Lang:         "en",
+		MacOSVersion: defaultMacOSVersion,
 		Dest:         "~/Pictures/backgrounds/aerials",
+		Retries:      3,
+		RetryBackoff: "1s",
+		NameTemplate: defaultNameTemplate,
+		MaxNameLen:   255,
+		Collision:    "shot-id",
 		logger:       func(string, ...any) {},
 	}
 	switch n := runtime.NumCPU(); {
@@ -74,23 +91,66 @@ func main() {
 			ox.Exec(args.doGrab),
 			ox.Usage("grab", "grab available aerials"),
 		),
+		ox.Sub(
+			ox.Exec(args.doPrune),
+			ox.Usage("prune", "prune aerials no longer available"),
+		),
+		ox.Sub(
+			ox.Exec(args.doLangs),
+			ox.Usage("langs", "list available languages"),
+		),
+		ox.Sub(
+			ox.Exec(args.doVersions),
+			ox.Usage("versions", "list macOS versions with available aerials"),
+		),
 	)
 }
 
 type Args struct {
-	Verbose      bool   `ox:"enable verbose,short:v"`
-	Quiet        bool   `ox:"enable quiet,short:q"`
-	MacOSVersion string `ox:"macOS version,name:macos-version"`
-	Streams      int    `ox:"concurrent streams"`
-	Sizes        bool   `ox:"show sizes"`
-	Dest         string `ox:"dest"`
-	M3u          string `ox:"m3u"`
-	UserAgent    string `ox:"user agent"`
-	Lang         string `ox:"language"`
+	Verbose      bool     `ox:"enable verbose,short:v"`
+	Quiet        bool     `ox:"enable quiet,short:q"`
+	MacOSVersion string   `ox:"macOS version (or latest),name:macos-version"`
+	Streams      int      `ox:"concurrent streams"`
+	Sizes        bool     `ox:"show sizes"`
+	Durations    bool     `ox:"show durations"`
+	Media        bool     `ox:"show media info"`
+	Export       string   `ox:"export media info as json to file"`
+	Variant      []string `ox:"preferred stream variants"`
+	MaxRes       string   `ox:"maximum resolution,name:max-resolution"`
+	Strict       bool     `ox:"fail on unknown fields and missing names in entries.json"`
+	Quirks       string   `ox:"entries.json quirks file"`
+	Format       string   `ox:"list output format (table|json|csv|tsv)"`
+	NameTemplate string   `ox:"file name template"`
+	ASCII        bool     `ox:"transliterate file names to ascii,name:ascii"`
+	MaxNameLen   int      `ox:"maximum file name length,name:max-name-length"`
+	Collision    string   `ox:"name collision strategy (error|shot-id|index|subcategory)"`
+	Dest         string   `ox:"dest"`
+	M3u          string   `ox:"m3u"`
+	M3uLang      []string `ox:"m3u playlist languages,name:m3u-lang"`
+	UserAgent    string   `ox:"user agent"`
+	Lang         []string `ox:"language fallback chain (default from locale)"`
+	Retries      int      `ox:"retries for transient errors"`
+	RetryBackoff string   `ox:"initial retry backoff"`
+	KeepGoing    bool     `ox:"keep going after asset errors"`
+	Category     []string `ox:"filter by category"`
+	Subcategory  []string `ox:"filter by subcategory"`
+	Include      []string `ox:"include assets matching glob"`
+	Exclude      []string `ox:"exclude assets matching glob"`
+	ShotID       []string `ox:"filter by shot id,name:shot-id"`
+	ShuffleOnly  bool     `ox:"only assets included in shuffle"`
+	TopLevelOnly bool     `ox:"only assets shown in top level"`
+	Prune        bool     `ox:"prune assets no longer available"`
+	Trash        string   `ox:"move pruned assets to trash directory"`
+	Yes          bool     `ox:"do not prompt for confirmation,short:y"`
+	Verify       bool     `ox:"verify checksums and retry media info of existing assets"`
 
-	resURL string
-	logger func(string, ...any)
-	err    error
+	resURL       string
+	res          *Resources
+	catalog      []Asset
+	manifest     *Manifest
+	retryBackoff time.Duration
+	logger       func(string, ...any)
+	err          error
 }
 
 // setup sets up the args.
@@ -101,6 +161,15 @@ func (args *Args) setup(ctx context.Context) error {
 			fmt.Fprintf(os.Stderr, s+"\n", v...)
 		}
 	}
+	var err error
+	if args.retryBackoff, err = time.ParseDuration(args.RetryBackoff); err != nil {
+		return fmt.Errorf("invalid retry backoff %q: %w", args.RetryBackoff, err)
+	}
+	switch args.Collision {
+	case "error", "shot-id", "index", "subcategory":
+	default:
+		return fmt.Errorf("invalid collision strategy %q", args.Collision)
+	}
 	if err := args.buildUserAgent(ctx); err != nil {
 		return err
 	}
@@ -128,22 +197,42 @@ func (args *Args) doList(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	if args.Sizes {
+	if err := args.filter(entries); err != nil {
+		return err
+	}
+	media := args.Durations || args.Media || args.Export != ""
+	if args.Sizes || media {
 		if err := args.getSizes(ctx, entries); err != nil {
 			return err
 		}
 	}
-	var total ox.Size
-	for i, asset := range entries.Assets {
-		var extra string
-		if args.Sizes {
-			extra = fmt.Sprintf(", %s", asset.Size)
+	if media {
+		if err := args.getMedia(ctx, entries); err != nil {
+			return err
 		}
-		fmt.Printf("%3d: %s (%s%s)\n", i+1, asset.String(), asset.ShotID, extra)
-		total += asset.Size
 	}
-	if args.Sizes {
-		fmt.Println("total:", total)
+	switch strings.ToLower(args.Format) {
+	case "", "table":
+		args.writeTable(entries)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(newRecords(entries))
+	case "csv":
+		err = writeRecords(os.Stdout, ',', entries)
+	case "tsv":
+		err = writeRecords(os.Stdout, '\t', entries)
+	default:
+		return fmt.Errorf("invalid format %q", args.Format)
+	}
+	if err != nil {
+		return err
+	}
+	if err := args.writeExport(entries); err != nil {
+		return err
+	}
+	if args.Sizes || media {
+		return args.checkErrs(entries)
 	}
 	return nil
 }
@@ -160,10 +249,16 @@ func (args *Args) doShow(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if err := args.filter(entries); err != nil {
+		return err
+	}
 	if err := args.getSizes(ctx, entries); err != nil {
 		return err
 	}
 	for _, asset := range entries.Assets {
+		if asset.Err != nil {
+			continue
+		}
 		fmt.Fprintf(os.Stdout, "%s (% .2z):\n", asset.String(), asset.Size)
 		body, err := args.get(ctx, asset.PreviewImage)
 		if err != nil {
@@ -180,7 +275,7 @@ func (args *Args) doShow(ctx context.Context) error {
 			continue
 		}
 	}
-	return nil
+	return args.checkErrs(entries)
 }
 
 // doGrab grabs assets.
@@ -193,24 +288,241 @@ func (args *Args) doGrab(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	for _, lang := range args.M3uLang {
+		if _, ok := args.res.FindLang(lang); !ok {
+			return fmt.Errorf("invalid m3u language %q", lang)
+		}
+	}
+	if err := args.filter(entries); err != nil {
+		return err
+	}
 	if err := args.getSizes(ctx, entries); err != nil {
 		return err
 	}
+	if !args.KeepGoing {
+		if err := args.checkErrs(entries); err != nil {
+			return err
+		}
+	}
 	if err := args.setDL(entries); err != nil {
 		return err
 	}
+	if args.Prune {
+		if err := args.prune(); err != nil {
+			return err
+		}
+	}
 	if err := args.getAssets(ctx, entries); err != nil {
 		return err
 	}
-	// TODO: move ffprobe duration read into actual asset read, and put as part
-	// TODO: of workload, to make go fast, vroom VROOM VROOOOOOOOOOOOM
+	if !args.KeepGoing {
+		if err := args.checkErrs(entries); err != nil {
+			_ = args.saveManifest(entries)
+			return err
+		}
+	}
 	if err := args.addDur(ctx, entries); err != nil {
 		return err
 	}
 	if err := args.writeM3U(entries); err != nil {
 		return err
 	}
+	if err := args.writeExport(entries); err != nil {
+		return err
+	}
+	if err := args.saveManifest(entries); err != nil {
+		return err
+	}
 	args.logger("total: %s", time.Since(start))
+	return args.checkErrs(entries)
+}
+
+// doPrune prunes assets no longer available.
+func (args *Args) doPrune(ctx context.Context) error {
+	if err := args.setup(ctx); err != nil {
+		return err
+	}
+	if _, err := args.getEntries(ctx); err != nil {
+		return err
+	}
+	u, err := user.Current()
+	if err != nil {
+		return err
+	}
+	if args.manifest, err = LoadManifest(filepath.Join(expand(u, args.Dest), manifestName)); err != nil {
+		return err
+	}
+	return args.prune()
+}
+
+// doLangs lists the available languages in the resources bundle, with the
+// coverage of the localized keys used by the entries.
+func (args *Args) doLangs(ctx context.Context) error {
+	if err := args.setup(ctx); err != nil {
+		return err
+	}
+	res, err := args.getResources(ctx)
+	if err != nil {
+		return err
+	}
+	entries, err := res.Entries()
+	if err != nil {
+		return err
+	}
+	keys := entries.Keys()
+	var langs []LangInfo
+	for _, lang := range res.Langs() {
+		m, err := res.Strings(lang)
+		if err != nil {
+			return err
+		}
+		langs = append(langs, newLangInfo(lang, m, keys))
+	}
+	switch strings.ToLower(args.Format) {
+	case "", "table":
+		for i, lang := range langs {
+			var name string
+			if lang.Name != "" {
+				name = lang.Name + ", "
+			}
+			fmt.Printf("%3d: %s (%s%d keys, %d/%d used, %.1f%%)\n", i+1, lang.Lang, name, lang.Keys, lang.Translated, lang.Used, lang.Coverage)
+			if args.Verbose {
+				for _, key := range lang.Missing {
+					fmt.Printf("     missing: %s\n", key)
+				}
+			}
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(langs)
+	default:
+		return fmt.Errorf("invalid format %q", args.Format)
+	}
+	return nil
+}
+
+// doVersions lists the macOS versions with available resources.
+func (args *Args) doVersions(ctx context.Context) error {
+	if err := args.setup(ctx); err != nil {
+		return err
+	}
+	versions, err := args.getVersions(ctx)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(args.Format) {
+	case "", "table":
+		for i, v := range versions {
+			fmt.Printf("%3d: %s (%s)\n", i+1, v.Version, v.ResourcesURL)
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(versions)
+	default:
+		return fmt.Errorf("invalid format %q", args.Format)
+	}
+	return nil
+}
+
+// prune removes (or moves to the trash directory) the files of assets in the
+// manifest that are no longer in the catalog, after confirmation. Files not
+// in the manifest are left alone.
+func (args *Args) prune() error {
+	if len(args.catalog) == 0 {
+		return errors.New("refusing to prune: catalog is empty")
+	}
+	u, err := user.Current()
+	if err != nil {
+		return err
+	}
+	baseDir, trashDir := expand(u, args.Dest), ""
+	if args.Trash != "" {
+		trashDir = expand(u, args.Trash)
+	}
+	keys := make(map[string]bool)
+	for _, asset := range args.catalog {
+		keys[asset.Key()] = true
+	}
+	stale := make(map[string]string)
+	sizes := make(map[string]ox.Size)
+	for key, m := range args.manifest.Assets {
+		if keys[key] {
+			continue
+		}
+		name := filepath.Join(baseDir, filepath.FromSlash(m.Path))
+		switch size, err := fileSize(name); {
+		case err != nil:
+			return err
+		case size != 0:
+			stale[name], sizes[name] = key, size
+		}
+	}
+	if len(stale) == 0 {
+		fmt.Println("prune: nothing to prune")
+		return nil
+	}
+	var total ox.Size
+	for _, name := range slices.Sorted(maps.Keys(stale)) {
+		rel, _ := filepath.Rel(baseDir, name)
+		fmt.Printf("prune: %s (% .2z)\n", rel, sizes[name])
+		total += sizes[name]
+	}
+	fmt.Printf("prune: %d files (% .2z)\n", len(stale), total)
+	if !args.Yes && !confirm("prune files?") {
+		return nil
+	}
+	for name, key := range stale {
+		switch {
+		case trashDir != "":
+			rel, _ := filepath.Rel(baseDir, name)
+			dest := filepath.Join(trashDir, rel)
+			args.logger("moving %s -> %s", name, dest)
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+			if err := moveFile(name, dest); err != nil {
+				return err
+			}
+		default:
+			args.logger("removing %s", name)
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+		}
+		removeEmpty(baseDir, filepath.Dir(name))
+		delete(args.manifest.Assets, key)
+	}
+	return args.manifest.Save(filepath.Join(baseDir, manifestName))
+}
+
+// filter filters the assets by the category, subcategory, include, exclude,
+// shot id, shuffle only and top level only flags. An asset must match all of
+// the set filters.
+func (args *Args) filter(entries *Entries) error {
+	for _, pattern := range append(slices.Clone(args.Include), args.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+	n := len(entries.Assets)
+	entries.Assets = slices.DeleteFunc(entries.Assets, func(asset Asset) bool {
+		keep := matchAny(args.Category, append(slices.Clone(asset.Categories), asset.CategoryNames...)) &&
+			matchAny(args.Subcategory, append(slices.Clone(asset.Subcategories), asset.SubcategoryNames...)) &&
+			matchAny(args.ShotID, []string{asset.ShotID, asset.ID}) &&
+			(len(args.Include) == 0 || matchGlobs(args.Include, asset.String())) &&
+			!matchGlobs(args.Exclude, asset.String()) &&
+			(!args.ShuffleOnly || asset.IncludeInShuffle) &&
+			(!args.TopLevelOnly || asset.ShowInTopLevel)
+		if !keep {
+			args.logger("filtered: %s (%s)", asset.String(), asset.ShotID)
+		}
+		return !keep
+	})
+	if len(entries.Assets) != n {
+		args.logger("filtered: %d of %d assets", n-len(entries.Assets), n)
+	}
 	return nil
 }
 
@@ -226,7 +538,11 @@ func (args *Args) getSizes(ctx context.Context, entries *Entries) error {
 		mpb.WithWidth(48),
 		mpb.WithWaitGroup(&wg),
 		mpb.WithAutoRefresh(),
+		mpb.WithOutput(args.progressOut()),
 	)
+	taskCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	tasks := make(map[int]pond.Task)
 	bar := pb.New(
 		int64(len(entries.Assets)),
 		mpb.BarStyle(),
@@ -246,11 +562,14 @@ func (args *Args) getSizes(ctx context.Context, entries *Entries) error {
 	)
 	for i, asset := range entries.Assets {
 		wg.Add(1)
-		pool.SubmitErr(func() error {
+		tasks[i] = pool.SubmitErr(func() error {
 			defer bar.Increment()
 			defer wg.Done()
-			var err error
-			if asset.Size, err = args.getSize(ctx, asset); err != nil {
+			if err := taskCtx.Err(); err != nil {
+				return err
+			}
+			if err := args.getSize(taskCtx, &asset); err != nil {
+				args.abort(cancel)
 				return err
 			}
 			entries.Assets[i] = asset
@@ -259,36 +578,309 @@ func (args *Args) getSizes(ctx context.Context, entries *Entries) error {
 	}
 	pool.StopAndWait()
 	pb.Wait()
+	args.setErrs(taskCtx, entries, tasks)
 	return nil
 }
 
-// setDL sets whether or not to download the assets.
+// progressOut returns the progress bar output, which is stderr when listing
+// in a machine readable format.
+func (args *Args) progressOut() io.Writer {
+	switch strings.ToLower(args.Format) {
+	case "", "table":
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// setDL sets whether or not to download the assets, using the manifest in
+// the destination to relocate previously downloaded assets.
 func (args *Args) setDL(entries *Entries) error {
 	u, err := user.Current()
 	if err != nil {
 		return err
 	}
 	baseDir := expand(u, args.Dest)
+	if args.manifest, err = LoadManifest(filepath.Join(baseDir, manifestName)); err != nil {
+		return err
+	}
 	for i, asset := range entries.Assets {
-		if asset.Size == 0 {
+		switch {
+		case asset.Err != nil:
+			continue
+		case asset.Size == 0:
 			return fmt.Errorf("%s has size 0", asset.String())
 		}
-		size, out := ox.Size(0), filepath.Join(baseDir, asset.String())
-		switch fi, err := os.Stat(out); {
-		case errors.Is(err, os.ErrNotExist):
+		entries.Assets[i].Out = filepath.Join(baseDir, asset.String())
+	}
+	if err := args.relocate(baseDir, entries); err != nil {
+		return err
+	}
+	for i, asset := range entries.Assets {
+		if asset.Err != nil {
+			continue
+		}
+		switch ok, err := args.checkManifest(baseDir, &asset); {
 		case err != nil:
 			return err
-		case fi.IsDir():
-			return fmt.Errorf("%s is a directory", out)
-		default:
-			size = ox.Size(fi.Size())
+		case ok:
+			entries.Assets[i] = asset
+			continue
+		}
+		size, err := fileSize(asset.Out)
+		if err != nil {
+			return err
+		}
+		asset.DL = size != asset.Size
+		if !asset.DL && args.Verify {
+			if asset.SHA256, err = sha256File(asset.Out); err != nil {
+				return err
+			}
+		}
+		// resume when the previous partial download has the same validator
+		if asset.DL {
+			if asset.Offset, err = resumeOffset(asset); err != nil {
+				return err
+			}
 		}
-		asset.Out, asset.DL = out, size != asset.Size
 		entries.Assets[i] = asset
 	}
+	return args.cleanParts(baseDir, entries)
+}
+
+// relocate moves previously downloaded assets whose path has changed (ie,
+// after a language change or a re-categorization) to their new path. Assets
+// are matched by the manifest, or by a unique size for files not in the
+// manifest or the trash directory. The renames are printed before being made,
+// and as they are lossless, are done without confirmation.
+func (args *Args) relocate(baseDir string, entries *Entries) error {
+	type move struct {
+		i    int
+		from string
+	}
+	var moves []move
+	var missing []int
+	claimed := make(map[string]bool)
+	for _, m := range args.manifest.Assets {
+		claimed[filepath.Join(baseDir, filepath.FromSlash(m.Path))] = true
+	}
+	for i, asset := range entries.Assets {
+		if asset.Err != nil {
+			continue
+		}
+		switch _, err := os.Stat(asset.Out); {
+		case err == nil:
+			continue
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+		prev, ok := args.manifest.Assets[asset.Key()]
+		if ok && prev.URL == asset.URL && prev.Size == int64(asset.Size) {
+			from := filepath.Join(baseDir, filepath.FromSlash(prev.Path))
+			if size, err := fileSize(from); err == nil && size == asset.Size {
+				moves = append(moves, move{i, from})
+				continue
+			}
+		}
+		missing = append(missing, i)
+	}
+	// match remaining assets by unique size against unknown files
+	if len(missing) != 0 {
+		trashDir := ""
+		if args.Trash != "" {
+			u, err := user.Current()
+			if err != nil {
+				return err
+			}
+			trashDir = expand(u, args.Trash)
+		}
+		stale, err := findStale(baseDir, trashDir, args.catalog)
+		if err != nil {
+			return err
+		}
+		files := make(map[ox.Size][]string)
+		for name, size := range stale {
+			if !claimed[name] {
+				files[size] = append(files[size], name)
+			}
+		}
+		counts := make(map[ox.Size]int)
+		for _, i := range missing {
+			counts[entries.Assets[i].Size]++
+		}
+		for _, i := range missing {
+			asset := entries.Assets[i]
+			if names := files[asset.Size]; len(names) == 1 && counts[asset.Size] == 1 && filepath.Ext(names[0]) == filepath.Ext(asset.Out) {
+				moves = append(moves, move{i, names[0]})
+			}
+		}
+	}
+	if len(moves) == 0 {
+		return nil
+	}
+	for _, m := range moves {
+		from, _ := filepath.Rel(baseDir, m.from)
+		to, _ := filepath.Rel(baseDir, entries.Assets[m.i].Out)
+		fmt.Printf("rename: %s -> %s\n", from, to)
+	}
+	for _, m := range moves {
+		asset := entries.Assets[m.i]
+		args.logger("renaming %s -> %s", m.from, asset.Out)
+		if err := os.MkdirAll(filepath.Dir(asset.Out), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(m.from, asset.Out); err != nil {
+			return err
+		}
+		removeEmpty(baseDir, filepath.Dir(m.from))
+		if prev, ok := args.manifest.Assets[asset.Key()]; ok {
+			rel, _ := filepath.Rel(baseDir, asset.Out)
+			prev.Path = filepath.ToSlash(rel)
+			args.manifest.Assets[asset.Key()] = prev
+		}
+	}
 	return nil
 }
 
+// checkManifest returns true when the manifest has a copy of the asset at the
+// asset's path, setting whether or not to download the asset based on its
+// validators, and on its checksum when verifying.
+func (args *Args) checkManifest(baseDir string, asset *Asset) (bool, error) {
+	prev, ok := args.manifest.Assets[asset.Key()]
+	switch {
+	case !ok,
+		prev.URL != asset.URL,
+		prev.Size != int64(asset.Size),
+		filepath.Join(baseDir, filepath.FromSlash(prev.Path)) != asset.Out:
+		return false, nil
+	}
+	if size, err := fileSize(asset.Out); err != nil || size != asset.Size {
+		return false, err
+	}
+	if modified(prev, *asset) {
+		args.logger("%s: remote changed for %s", asset.ShotID, asset.Out)
+		asset.DL, asset.Offset = true, 0
+		return true, nil
+	}
+	asset.SHA256, asset.Dur, asset.Media = prev.SHA256, prev.Dur, prev.Media
+	// failures from an older media parser are retried
+	if prev.MediaVersion == movVersion {
+		asset.MediaErr = prev.MediaErr
+	}
+	if args.Verify {
+		sum, err := sha256File(asset.Out)
+		switch {
+		case err != nil:
+			return false, err
+		case prev.SHA256 != "" && sum != prev.SHA256:
+			args.logger("%s: checksum mismatch for %s", asset.ShotID, asset.Out)
+			asset.SHA256, asset.DL = "", true
+			return true, nil
+		}
+		asset.SHA256 = sum
+	}
+	return true, nil
+}
+
+// modified returns true when the remote asset's etag, or last modified time
+// when either has no etag, differs from the manifest's.
+func modified(prev ManifestAsset, asset Asset) bool {
+	switch {
+	case prev.ETag != "" && asset.ETag != "":
+		return prev.ETag != asset.ETag
+	case prev.LastModified != "" && asset.LastModified != "":
+		return prev.LastModified != asset.LastModified
+	}
+	return false
+}
+
+// saveManifest saves the completed assets to the manifest in the destination,
+// dropping previous assets no longer present on disk.
+func (args *Args) saveManifest(entries *Entries) error {
+	if args.manifest == nil {
+		return nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return err
+	}
+	baseDir := expand(u, args.Dest)
+	now := time.Now()
+	for _, asset := range entries.Assets {
+		if asset.Err != nil || asset.Out == "" {
+			continue
+		}
+		if size, err := fileSize(asset.Out); err != nil || size != asset.Size {
+			continue
+		}
+		rel, err := filepath.Rel(baseDir, asset.Out)
+		if err != nil {
+			return err
+		}
+		m := ManifestAsset{
+			ID:           asset.ID,
+			ShotID:       asset.ShotID,
+			URL:          asset.URL,
+			ETag:         asset.ETag,
+			LastModified: asset.LastModified,
+			Size:         int64(asset.Size),
+			SHA256:       asset.SHA256,
+			Dur:          asset.Dur,
+			Media:        asset.Media,
+			MediaErr:     asset.MediaErr,
+			Path:         filepath.ToSlash(rel),
+			Time:         now,
+		}
+		if asset.MediaErr != "" {
+			m.MediaVersion = movVersion
+		}
+		if prev, ok := args.manifest.Assets[asset.Key()]; ok && !asset.DL {
+			m.Time = prev.Time
+		}
+		args.manifest.Assets[asset.Key()] = m
+	}
+	for key, m := range args.manifest.Assets {
+		if size, err := fileSize(filepath.Join(baseDir, filepath.FromSlash(m.Path))); err != nil || size != ox.Size(m.Size) {
+			args.logger("%s: removing from manifest: %s", m.ShotID, m.Path)
+			delete(args.manifest.Assets, key)
+		}
+	}
+	return args.manifest.Save(filepath.Join(baseDir, manifestName))
+}
+
+// cleanParts removes stale partial downloads in the base directory that will
+// not be resumed. Partial downloads of catalog assets excluded by the filters
+// are kept.
+func (args *Args) cleanParts(baseDir string, entries *Entries) error {
+	keep := make(map[string]bool)
+	// keep partial downloads of filtered assets
+	for _, asset := range args.catalog {
+		name := filepath.Join(baseDir, asset.String()) + partExt
+		keep[name], keep[name+resumeExt] = true, true
+	}
+	for _, asset := range entries.Assets {
+		if !asset.DL || asset.Offset == 0 {
+			delete(keep, asset.Part())
+			delete(keep, asset.Part()+resumeExt)
+		}
+	}
+	err := filepath.WalkDir(baseDir, func(name string, d os.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir(),
+			keep[name],
+			!strings.HasSuffix(name, partExt) && !strings.HasSuffix(name, partExt+resumeExt):
+			return nil
+		}
+		args.logger("removing stale: %s", name)
+		return os.Remove(name)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
 func (args *Args) getAssets(ctx context.Context, entries *Entries) error {
 	if len(entries.Assets) < 1 {
 		return nil
@@ -310,110 +902,447 @@ func (args *Args) getAssets(ctx context.Context, entries *Entries) error {
 		mpb.WithWaitGroup(&wg),
 		mpb.WithAutoRefresh(),
 	)
-	for _, asset := range entries.Assets {
-		if !asset.DL {
+	taskCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	tasks := make(map[int]pond.Task)
+	for i, asset := range entries.Assets {
+		if !asset.DL || asset.Err != nil {
 			continue
 		}
 		args.logger("%s -> %s (% .2z)", asset.ShotID, asset.Out, asset.Size)
 		wg.Add(1)
-		pool.SubmitErr(func() error {
+		tasks[i] = pool.SubmitErr(func() error {
 			defer wg.Done()
-			if err := os.MkdirAll(filepath.Dir(asset.Out), 0o755); err != nil {
-				return err
-			}
-			// out
-			f, err := os.OpenFile(asset.Out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
-			if err != nil {
-				return err
-			}
-			defer f.Close()
-			// build client and request
-			cl, err := args.client(ctx, false)
-			if err != nil {
-				return err
-			}
-			args.logger("GET %s", asset.URL4kSdr240FPS)
-			req, err := args.newReq(ctx, "GET", asset.URL4kSdr240FPS, nil)
-			if err != nil {
+			if err := taskCtx.Err(); err != nil {
 				return err
 			}
-			// execute
-			res, err := cl.Do(req)
-			if err != nil {
+			if err := args.getAsset(taskCtx, pb, n, &entries.Assets[i]); err != nil {
+				args.abort(cancel)
 				return err
 			}
-			defer res.Body.Close()
-			// progress bar
-			bar := pb.New(
-				int64(asset.Size),
-				mpb.BarStyle(),
-				mpb.PrependDecorators(
-					decor.Name(fmt.Sprintf("%- *s", n+2, asset.String()+": ")),
-				),
-				mpb.AppendDecorators(
-					decor.OnComplete(
-						decor.EwmaSpeed(decor.SizeB1024(0), "%- 4.2f", 0),
-						"done",
-					),
-				),
-			)
-			// copy
-			r := bar.ProxyReader(res.Body)
-			defer r.Close()
-			_, err = io.Copy(f, r)
-			return err
+			args.addMedia(taskCtx, &entries.Assets[i])
+			return nil
 		})
 	}
 	pool.StopAndWait()
 	pb.Wait()
+	args.setErrs(taskCtx, entries, tasks)
 	return nil
 }
 
-func (args *Args) getNames(ctx context.Context) (map[string]string, error) {
-	buf, err := args.getTarFile(ctx, "./TVIdleScreenStrings.bundle/"+args.Lang+".lproj/Localizable.nocache.strings")
-	if err != nil {
-		return nil, fmt.Errorf("could not find plist for language %s", args.Lang)
+// abort cancels the remaining tasks after an asset error, unless keep going
+// is enabled.
+func (args *Args) abort(cancel context.CancelCauseFunc) {
+	if !args.KeepGoing {
+		cancel(errAborted)
 	}
-	m := make(map[string]string)
-	if err := plist.Unmarshal(buf, &m); err != nil {
+}
+
+// setErrs sets the errors from the completed tasks on the assets. Errors
+// caused by aborting the remaining tasks are ignored.
+func (args *Args) setErrs(ctx context.Context, entries *Entries, tasks map[int]pond.Task) {
+	for i, task := range tasks {
+		err := task.Wait()
+		switch {
+		case err == nil,
+			errors.Is(err, context.Canceled) && context.Cause(ctx) == errAborted:
+			continue
+		}
+		args.logger("%s: error: %v", entries.Assets[i].ShotID, err)
+		entries.Assets[i].Err = err
+	}
+}
+
+// warn prints a warning to stderr, unless quiet.
+func (args *Args) warn(s string, v ...any) {
+	if !args.Quiet {
+		fmt.Fprintf(os.Stderr, s+"\n", v...)
+	}
+}
+
+// localeName returns the system locale name for messages from the
+// environment.
+func localeName() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if s := os.Getenv(key); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// checkErrs prints a summary of the failed assets, returning an error when
+// any asset failed.
+func (args *Args) checkErrs(entries *Entries) error {
+	var n int
+	for _, asset := range entries.Assets {
+		if asset.Err == nil {
+			continue
+		}
+		if n == 0 {
+			fmt.Fprintln(os.Stderr, "failed:")
+		}
+		fmt.Fprintf(os.Stderr, "  %s (%s): %v\n", asset.String(), asset.ShotID, asset.Err)
+		n++
+	}
+	if n != 0 {
+		return fmt.Errorf("%d of %d assets failed", n, len(entries.Assets))
+	}
+	return nil
+}
+
+// getAsset retrieves a single asset, resuming a previously interrupted
+// download when the remote validator still matches. Transient errors are
+// retried, resuming from the partial download when possible.
+func (args *Args) getAsset(ctx context.Context, pb *mpb.Progress, n int, asset *Asset) error {
+	if err := os.MkdirAll(filepath.Dir(asset.Out), 0o755); err != nil {
+		return err
+	}
+	// previous partial download was complete
+	if asset.Offset == asset.Size {
+		return finishPart(asset)
+	}
+	// build client
+	cl, err := args.client(ctx, false)
+	if err != nil {
+		return err
+	}
+	// progress bar
+	bar := pb.New(
+		int64(asset.Size),
+		mpb.BarStyle(),
+		mpb.PrependDecorators(
+			decor.Name(fmt.Sprintf("%- *s", n+2, asset.String()+": ")),
+		),
+		mpb.AppendDecorators(
+			decor.OnComplete(
+				decor.EwmaSpeed(decor.SizeB1024(0), "%- 4.2f", 0),
+				"done",
+			),
+		),
+	)
+	var retries int
+	defer func() {
+		args.logger("%s: %d retries", asset.ShotID, retries)
+	}()
+	for {
+		i, err := args.copyAsset(ctx, cl, bar, *asset)
+		retries += i
+		switch {
+		case err == nil:
+			return finishPart(asset)
+		case retries >= args.Retries || !retryable(ctx, err):
+			bar.Abort(false)
+			return err
+		}
+		retries++
+		d := args.backoff(retries, nil)
+		args.logger("%s: retry %d/%d in %s: %v", asset.ShotID, retries, args.Retries, d, err)
+		if err := sleep(ctx, d); err != nil {
+			bar.Abort(false)
+			return err
+		}
+		if asset.Offset, err = resumeOffset(*asset); err != nil {
+			bar.Abort(false)
+			return err
+		}
+	}
+}
+
+// copyAsset copies the remote asset to its partial download file. Returns the
+// number of retries used opening the remote asset.
+func (args *Args) copyAsset(ctx context.Context, cl *http.Client, bar *mpb.Bar, asset Asset) (int, error) {
+	// execute
+	res, offset, retries, err := args.openAsset(ctx, cl, asset)
+	if err != nil {
+		return retries, err
+	}
+	defer res.Body.Close()
+	// out
+	flag := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(asset.Part(), flag, 0o644)
+	if err != nil {
+		return retries, err
+	}
+	defer f.Close()
+	// save validator, so an interrupted download can be resumed
+	if v := asset.Validator(); v != "" {
+		if err := os.WriteFile(asset.Part()+resumeExt, []byte(v), 0o644); err != nil {
+			return retries, err
+		}
+	}
+	bar.SetCurrent(int64(offset))
+	if offset != 0 {
+		bar.SetRefill(int64(offset))
+	}
+	// copy
+	r := bar.ProxyReader(res.Body)
+	defer r.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return retries, err
+	}
+	if err := f.Sync(); err != nil {
+		return retries, err
+	}
+	return retries, f.Close()
+}
+
+// finishPart verifies the size of a completed partial download, sets its
+// checksum, and renames it into place.
+func finishPart(asset *Asset) error {
+	size, err := fileSize(asset.Part())
+	switch {
+	case err != nil:
+		return err
+	case size != asset.Size:
+		if size > asset.Size {
+			_ = os.Remove(asset.Part())
+			_ = os.Remove(asset.Part() + resumeExt)
+		}
+		return fmt.Errorf("%s: expected size %d, got %d", asset.ShotID, asset.Size, size)
+	}
+	if asset.SHA256, err = sha256File(asset.Part()); err != nil {
+		return err
+	}
+	if err := os.Rename(asset.Part(), asset.Out); err != nil {
+		return err
+	}
+	switch err := os.Remove(asset.Part() + resumeExt); {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+// openAsset opens the remote asset, requesting only the remaining bytes when
+// asset has a resumable offset. Returns the response, the offset the response
+// body starts at (0 when the server sent the full asset), and the number of
+// retries.
+func (args *Args) openAsset(ctx context.Context, cl *http.Client, asset Asset) (*http.Response, ox.Size, int, error) {
+	offset, retries := asset.Offset, 0
+	for {
+		args.logger("GET %s (offset: %d)", asset.URL, offset)
+		req, err := args.newReq(ctx, "GET", asset.URL, nil)
+		if err != nil {
+			return nil, 0, retries, err
+		}
+		if offset != 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", asset.Validator())
+		}
+		res, i, err := args.do(cl, req)
+		retries += i
+		if err != nil {
+			return nil, 0, retries, err
+		}
+		switch {
+		case offset != 0 && res.StatusCode == http.StatusPartialContent:
+			if start, ok := contentRangeStart(res.Header.Get("Content-Range")); !ok || start != offset {
+				_ = res.Body.Close()
+				return nil, 0, retries, fmt.Errorf("%s: unexpected content range %q", asset.ShotID, res.Header.Get("Content-Range"))
+			}
+			return res, offset, retries, nil
+		case offset != 0 && res.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+			_ = res.Body.Close()
+			args.logger("%s: range not satisfiable, fetching full", asset.ShotID)
+			offset = 0
+			continue
+		case res.StatusCode == http.StatusOK:
+			if offset != 0 {
+				args.logger("%s: range ignored, fetching full", asset.ShotID)
+			}
+			return res, 0, retries, nil
+		}
+		_ = res.Body.Close()
+		return nil, 0, retries, &statusError{method: "GET", urlstr: asset.URL, code: res.StatusCode, status: res.Status}
+	}
+}
+
+// selectVariant selects the stream variant for the asset, returning false
+// when the asset has no variants. Variants are ordered by highest
+// resolution, then SDR before HDR, then highest frame rate, then the default
+// codec. Variants above the maximum resolution are skipped, falling back to
+// the lowest available resolution when none fit. The variants matching the
+// variant flags are preferred, in order, falling back to the best variant
+// when none are available.
+func (args *Args) selectVariant(asset *Asset, maxHeight int) bool {
+	var variants []Variant
+	for key := range asset.Variants {
+		variants = append(variants, ParseVariant(key))
+	}
+	if len(variants) == 0 {
+		args.warn("warning: %s: no stream variants", asset.ShotID)
+		return false
+	}
+	slices.SortFunc(variants, func(a, b Variant) int {
+		switch {
+		case a.Height != b.Height:
+			return b.Height - a.Height
+		case a.HDR != b.HDR:
+			if a.HDR {
+				return 1
+			}
+			return -1
+		case a.FPS != b.FPS:
+			return b.FPS - a.FPS
+		case (a.Codec == "") != (b.Codec == ""):
+			if a.Codec != "" {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	if maxHeight != 0 {
+		// fall back to the lowest resolution when none fit
+		height := max(maxHeight, variants[len(variants)-1].Height)
+		if height != maxHeight {
+			args.logger("%s: no variant within %dp, using %dp", asset.ShotID, maxHeight, height)
+		}
+		variants = slices.DeleteFunc(variants, func(v Variant) bool {
+			return v.Height > height
+		})
+	}
+	if len(args.Variant) != 0 {
+		rank := func(v Variant) int {
+			if i := slices.IndexFunc(args.Variant, v.Is); i != -1 {
+				return i
+			}
+			return len(args.Variant)
+		}
+		slices.SortStableFunc(variants, func(a, b Variant) int {
+			return rank(a) - rank(b)
+		})
+		if rank(variants[0]) == len(args.Variant) {
+			args.logger("%s: no preferred variant in %v, using %s", asset.ShotID, slices.Sorted(maps.Keys(asset.Variants)), variants[0].Key)
+		}
+	}
+	asset.VariantKey, asset.URL = variants[0].Key, asset.Variants[variants[0].Key]
+	return true
+}
+
+// checkVariants checks that each of the variant flags matches a variant of
+// at least one asset.
+func (args *Args) checkVariants(assets []Asset) error {
+	m := make(map[string]bool)
+	for _, asset := range assets {
+		for key := range asset.Variants {
+			m[key] = true
+		}
+	}
+	keys := slices.Sorted(maps.Keys(m))
+	for _, s := range args.Variant {
+		if !slices.ContainsFunc(keys, func(key string) bool {
+			return ParseVariant(key).Is(s)
+		}) {
+			return fmt.Errorf("invalid variant %q (available: %s)", s, strings.Join(keys, ", "))
+		}
+	}
+	return nil
+}
+
+// getNames gets the localized strings for the language chain, resolving each
+// key from the first language that has it.
+func (args *Args) getNames(ctx context.Context) (map[string]string, error) {
+	res, err := args.getResources(ctx)
+	if err != nil {
 		return nil, err
 	}
-	for _, k := range slices.Sorted(maps.Keys(m)) {
-		m[k] = strings.Join(strings.FieldsFunc(m[k], func(r rune) bool {
-			return unicode.IsSpace(r) || !unicode.IsPrint(r)
-		}), " ")
-		args.logger("%s[%s]: %q", args.Lang, k, m[k])
+	langs := args.Lang
+	if len(langs) == 0 {
+		langs = res.LocaleLangs(localeName())
+		args.logger("langs: %s", strings.Join(langs, ", "))
 	}
-	return m, nil
+	names, found := make(map[string]string), false
+	for _, lang := range langs {
+		name, ok := res.FindLang(lang)
+		if !ok {
+			args.warn("warning: language %s not available", lang)
+			continue
+		}
+		m, err := res.Strings(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			if _, ok := names[k]; !ok && m[k] != "" {
+				names[k] = m[k]
+				args.logger("%s[%s]: %q", name, k, m[k])
+			}
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("no available language in %s", strings.Join(langs, ", "))
+	}
+	return names, nil
 }
 
 // getEntries gets the asset entries.
 func (args *Args) getEntries(ctx context.Context) (*Entries, error) {
-	buf, err := args.getTarFile(ctx, "./entries.json")
+	res, err := args.getResources(ctx)
 	if err != nil {
 		return nil, err
 	}
-	entries := new(Entries)
-	dec := json.NewDecoder(bytes.NewReader(buf))
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(entries); err != nil {
+	entries, err := res.Entries()
+	if err != nil {
 		return nil, err
 	}
+	if unknown := entries.Unknown(); len(unknown) != 0 {
+		if args.Strict {
+			return nil, fmt.Errorf("unknown fields in %s: %s", entriesJSON, strings.Join(unknown, ", "))
+		}
+		for _, s := range unknown {
+			args.logger("warning: unknown field in %s: %s", entriesJSON, s)
+		}
+	}
 	names, err := args.getNames(ctx)
 	if err != nil {
 		return nil, err
 	}
+	maxHeight, err := parseRes(args.MaxRes)
+	if err != nil {
+		return nil, err
+	}
+	if err := args.checkVariants(entries.Assets); err != nil {
+		return nil, err
+	}
+	assets := entries.Assets[:0]
+	for _, asset := range entries.Assets {
+		if args.selectVariant(&asset, maxHeight) {
+			assets = append(assets, asset)
+		}
+	}
+	entries.Assets = assets
+	quirks, err := args.loadQuirks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	quirk := quirks.Get(args.MacOSVersion)
+	unresolved := make(map[string]int)
 	for i, asset := range entries.Assets {
-		asset.Name = names[asset.LocalizedNameKey]
+		if asset.Name = names[asset.LocalizedNameKey]; asset.Name == "" {
+			if args.Strict {
+				return nil, fmt.Errorf("%s: no name for %s", asset.ShotID, asset.LocalizedNameKey)
+			}
+			args.warn("warning: %s: no name for %s, using shot id", asset.ShotID, asset.LocalizedNameKey)
+			asset.Name = asset.ShotID
+		}
 		// add category names
 		asset.CategoryNames = make([]string, len(asset.Categories))
 		for i, id := range asset.Categories {
-			if args.MacOSVersion == "v26.0" && strings.HasPrefix(id, "A33A55D9-EDEA-4596-A850-") {
-				id = "A33A55D9-EDEA-4596-A850-6C10B54FBBB5"
+			id, key := quirk.Category(id)
+			if key == "" {
+				key = entries.GetCategory(id)
 			}
-			s := names[entries.GetCategory(id)]
+			s := names[key]
 			if s == "" {
 				s = id
+				unresolved["category "+id]++
 			}
 			asset.CategoryNames[i] = s
 			args.logger("cat %s %d: %s -> %q", asset.LocalizedNameKey, i, id, s)
@@ -421,18 +1350,39 @@ func (args *Args) getEntries(ctx context.Context) (*Entries, error) {
 		// add subcategory names
 		asset.SubcategoryNames = make([]string, len(asset.Subcategories))
 		for i, id := range asset.Subcategories {
-			s := names[entries.GetSubcategory(asset.Categories, id)]
+			id, key := quirk.Subcategory(id)
+			if key == "" {
+				key = entries.GetSubcategory(asset.Categories, id)
+			}
+			s := names[key]
 			if s == "" {
 				s = id
-			}
-			if args.MacOSVersion == "v26.0" && id == "0DC99DD8-3386-4D1E-8878-C43E97EB710A" {
-				s = names["AerialSubcategoryTahoe"]
+				unresolved["subcategory "+id]++
 			}
 			asset.SubcategoryNames[i] = s
 			args.logger("subcat %s %d: %s -> %q", asset.LocalizedNameKey, i, id, s)
 		}
 		entries.Assets[i] = asset
 	}
+	for _, k := range slices.Sorted(maps.Keys(unresolved)) {
+		if args.Strict {
+			return nil, fmt.Errorf("unresolved %s", k)
+		}
+		args.warn("warning: unresolved %s (%d assets)", k, unresolved[k])
+	}
+	// build paths
+	tpl, err := template.New("name").Funcs(nameFuncs).Parse(args.NameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+	for i, asset := range entries.Assets {
+		if entries.Assets[i].Path, err = args.buildPath(tpl, asset); err != nil {
+			return nil, fmt.Errorf("%s: %w", asset.ShotID, err)
+		}
+	}
+	if err := args.resolveCollisions(entries.Assets); err != nil {
+		return nil, err
+	}
 	m := make(map[string]bool)
 	for _, asset := range entries.Assets {
 		name := asset.String()
@@ -444,65 +1394,94 @@ func (args *Args) getEntries(ctx context.Context) (*Entries, error) {
 	sort.Slice(entries.Assets, func(i, j int) bool {
 		return entries.Assets[i].String() < entries.Assets[j].String()
 	})
+	// keep the unfiltered catalog
+	args.catalog = slices.Clone(entries.Assets)
 	return entries, nil
 }
 
+// loadQuirks loads the entries.json quirks, overridden by the quirks file
+// when set, or the quirks file in the user config directory when present.
+func (args *Args) loadQuirks(ctx context.Context) (Quirks, error) {
+	var name string
+	switch dir, err := os.UserConfigDir(); {
+	case args.Quirks != "":
+		u, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		name = expand(u, args.Quirks)
+	case err == nil:
+		c, _ := ox.Ctx(ctx)
+		s := filepath.Join(dir, c.Root.Name, quirksFile)
+		if _, err := os.Stat(s); err == nil {
+			name = s
+		}
+	}
+	if name != "" {
+		args.logger("quirks: %s", name)
+	}
+	return LoadQuirks(name)
+}
+
+// listLangs lists the available languages in the resources bundle.
 func (args *Args) listLangs(ctx context.Context) error {
-	body, err := args.get(ctx, args.resURL)
+	res, err := args.getResources(ctx)
 	if err != nil {
 		return err
 	}
-	defer body.Close()
-	for r := tar.NewReader(body); ; {
-		switch h, err := r.Next(); {
-		case err != nil && errors.Is(err, io.EOF):
-			return nil
-		case err != nil:
-			return err
-		case strings.HasPrefix(h.Name, "./TVIdleScreenStrings.bundle/") && strings.HasSuffix(h.Name, ".lproj/Localizable.nocache.strings"):
-			args.logger("lang: %s",
-				strings.TrimSuffix(strings.TrimPrefix(h.Name, "./TVIdleScreenStrings.bundle/"), ".lproj/Localizable.nocache.strings"),
-			)
-		}
+	for _, lang := range res.Langs() {
+		args.logger("lang: %s", lang)
 	}
+	return nil
 }
 
-func (args *Args) getTarFile(ctx context.Context, name string) ([]byte, error) {
+// getResources retrieves and reads the resources bundle, once.
+func (args *Args) getResources(ctx context.Context) (*Resources, error) {
+	if args.res != nil {
+		return args.res, nil
+	}
+	now := time.Now()
 	body, err := args.get(ctx, args.resURL)
 	if err != nil {
 		return nil, err
 	}
 	defer body.Close()
-	args.logger("reading tar for: %s", name)
-	for r := tar.NewReader(body); ; {
-		switch h, err := r.Next(); {
-		case err != nil:
-			return nil, err
-		case h.Name == name:
-			return io.ReadAll(r)
-		}
+	if args.res, err = ReadResources(body); err != nil {
+		return nil, err
 	}
+	args.logger("read resources: %d files (%s)", len(args.res.files), time.Since(now))
+	return args.res, nil
 }
 
-// getSize gets the size for an asset, by performing a HEAD against the url.
-func (args *Args) getSize(ctx context.Context, asset Asset) (ox.Size, error) {
+// getSize gets the size and validators for an asset, by performing a HEAD
+// against the url.
+func (args *Args) getSize(ctx context.Context, asset *Asset) error {
 	args.logger("checking: %s %s", asset.ShotID, asset.String())
-	args.logger("HEAD %s", asset.URL4kSdr240FPS)
+	args.logger("HEAD %s", asset.URL)
 	cl, err := args.client(ctx, true)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	req, err := args.newReq(ctx, "HEAD", asset.URL4kSdr240FPS, nil)
+	req, err := args.newReq(ctx, "HEAD", asset.URL, nil)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	req.Header.Set("User-Agent", args.UserAgent)
-	res, err := cl.Do(req)
+	res, retries, err := args.do(cl, req)
+	args.logger("%s: %d retries", asset.ShotID, retries)
 	if err != nil {
-		return 0, err
+		return err
 	}
 	defer res.Body.Close()
-	return ox.Size(res.ContentLength), nil
+	if res.StatusCode != http.StatusOK {
+		return &statusError{method: "HEAD", urlstr: asset.URL, code: res.StatusCode, status: res.Status}
+	}
+	if res.ContentLength <= 0 {
+		return fmt.Errorf("HEAD %s: unknown content length", asset.URL)
+	}
+	asset.Size = ox.Size(res.ContentLength)
+	asset.ETag = res.Header.Get("ETag")
+	asset.LastModified = res.Header.Get("Last-Modified")
+	return nil
 }
 
 func (args *Args) writeM3U(entries *Entries) error {
@@ -518,6 +1497,27 @@ func (args *Args) writeM3U(entries *Entries) error {
 	if baseDir != filepath.Dir(out) {
 		return fmt.Errorf("invalid m3u file name %q", args.M3u)
 	}
+	if len(args.M3uLang) == 0 {
+		return args.writePlaylist(out, entries, nil)
+	}
+	// write a playlist per language
+	ext := filepath.Ext(out)
+	for _, lang := range args.M3uLang {
+		name, _ := args.res.FindLang(lang)
+		names, err := args.res.Strings(name)
+		if err != nil {
+			return err
+		}
+		if err := args.writePlaylist(strings.TrimSuffix(out, ext)+"."+lang+ext, entries, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePlaylist writes a m3u playlist of the downloaded assets to out, using
+// the localized names for the titles when not nil.
+func (args *Args) writePlaylist(out string, entries *Entries, names map[string]string) error {
 	f, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
 	if err != nil {
 		return err
@@ -526,71 +1526,222 @@ func (args *Args) writeM3U(entries *Entries) error {
 	// title
 	fmt.Fprintln(f, "#PLAYLIST: Wallpapers")
 	for _, asset := range entries.Assets {
-		fmt.Fprintf(f, "#EXTINF:%d,%s\n", int(asset.Dur.Seconds()), asset.Name)
+		// skip incomplete downloads
+		if size, err := fileSize(asset.Out); err != nil || size != asset.Size {
+			args.logger("skipping %s: incomplete", asset.Out)
+			continue
+		}
+		dur := -1
+		if asset.Dur > 0 {
+			dur = int(math.Ceil(asset.Dur.Seconds()))
+		}
+		title := asset.Name
+		if s := names[asset.LocalizedNameKey]; s != "" {
+			title = s
+		}
+		fmt.Fprintf(f, "#EXTINF:%d,%s\n", dur, title)
 		fmt.Fprintln(f, asset.String())
 	}
 	return f.Close()
 }
 
-// addDur loads the durations of the files using ffprobe.
+// addDur loads the durations and media info of the files that were not
+// downloaded and do not have cached media info, or a cached failure reading
+// it. Cached failures are retried when verifying.
 func (args *Args) addDur(ctx context.Context, entries *Entries) error {
+	pool := pond.NewPool(args.Streams, pond.WithContext(ctx))
 	for i, asset := range entries.Assets {
-		dur, err := ffprobeDuration(ctx, asset.Out)
-		if err != nil {
-			return err
+		if asset.Err != nil || asset.DL || asset.Media != nil || asset.MediaErr != "" && !args.Verify {
+			continue
 		}
-		asset.Dur = time.Duration(dur) * time.Second
-		args.logger("%s duration %s", asset.Out, asset.Dur)
-		entries.Assets[i] = asset
+		pool.Submit(func() {
+			args.addMedia(ctx, &entries.Assets[i])
+		})
 	}
+	pool.StopAndWait()
 	return nil
 }
 
-// buildUserAgent builds the user agent.
-func (args *Args) buildUserAgent(ctx context.Context) error {
-	if args.UserAgent != "" {
-		return nil
-	}
-	c, _ := ox.Ctx(ctx)
-	cache, err := newDiskCache(c.Root.Name, http.DefaultTransport.(*http.Transport).Clone())
+// addMedia adds the duration and media info of the asset's file, recording
+// the failure when it cannot be read. Failures caused by the environment (ie,
+// ffprobe not being installed) are not recorded, so they are retried.
+func (args *Args) addMedia(ctx context.Context, asset *Asset) {
+	info, err := args.fileMedia(ctx, asset.Out)
 	if err != nil {
-		return err
+		args.logger("%s: unable to determine duration: %v", asset.Out, err)
+		asset.Dur, asset.Media, asset.MediaErr = 0, nil, err.Error()
+		if errors.Is(err, errNoFFprobe) || errors.Is(err, os.ErrNotExist) || ctx.Err() != nil {
+			asset.MediaErr = ""
+		}
+		return
 	}
-	args.UserAgent, err = verhist.UserAgent(
-		ctx,
-		verhist.PlatformString(),
-		verhist.Stable.String(),
-		verhist.WithTransport(cache),
-	)
-	return err
+	args.logger("%s media %s", asset.Out, info)
+	asset.Dur, asset.Media, asset.MediaErr = info.Duration, info, ""
 }
 
-// init initializes the ca certs using during http requests.
-func (args *Args) init() error {
-	caCertsOnce.Do(func() {
-		if caCerts, args.err = x509.SystemCertPool(); args.err != nil {
-			return
-		}
-		if ok := caCerts.AppendCertsFromPEM(appleCABundlePEM); !ok {
-			args.err = errors.New("unable to append apple_ca_bundle.pem to system certs")
-			return
+// getMedia gets the durations and media info of the remote assets, by reading
+// the moov atom using range requests.
+func (args *Args) getMedia(ctx context.Context, entries *Entries) error {
+	cl, err := args.client(ctx, false)
+	if err != nil {
+		return err
+	}
+	pool := pond.NewPool(args.Streams, pond.WithContext(ctx))
+	for i, asset := range entries.Assets {
+		if asset.Err != nil {
+			continue
 		}
-	})
-	return args.err
+		pool.Submit(func() {
+			r := &rangeReader{ctx: ctx, args: args, cl: cl, urlstr: asset.URL}
+			info, err := ReadMov(r, int64(asset.Size))
+			if err != nil {
+				entries.Assets[i].Err = fmt.Errorf("unable to read remote media info: %w", err)
+				return
+			}
+			args.logger("%s media %s", asset.ShotID, info)
+			entries.Assets[i].Dur, entries.Assets[i].Media = info.Duration, info
+		})
+	}
+	pool.StopAndWait()
+	return nil
 }
 
-// client returns the http client using the shared cache.
-func (args *Args) client(ctx context.Context, cache bool) (*http.Client, error) {
-	if err := args.init(); err != nil {
+// fileMedia reads the media info of a local file, using ffprobe to determine
+// only the duration when the file cannot be parsed.
+func (args *Args) fileMedia(ctx context.Context, name string) (*MovInfo, error) {
+	f, err := os.Open(name)
+	if err != nil {
 		return nil, err
 	}
-	var transport http.RoundTripper = http.DefaultTransport.(*http.Transport).Clone()
-	transport.(*http.Transport).TLSClientConfig = &tls.Config{
-		InsecureSkipVerify: false,
-		RootCAs:            caCerts,
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
 	}
-	if cache {
-		if args.Verbose {
+	info, err := ReadMov(f, fi.Size())
+	if err == nil {
+		return info, nil
+	}
+	args.logger("%s: unable to read moov atom: %v", name, err)
+	switch dur, err := ffprobeDuration(ctx, name); {
+	case err != nil:
+		return nil, err
+	case dur < 0:
+		return nil, errNoFFprobe
+	default:
+		return &MovInfo{Duration: time.Duration(dur) * time.Second}, nil
+	}
+}
+
+// writeTable writes the assets as a human readable table.
+func (args *Args) writeTable(entries *Entries) {
+	var total ox.Size
+	for i, asset := range entries.Assets {
+		var extra string
+		if asset.IncludeInShuffle {
+			extra += ", shuffle"
+		}
+		if asset.ShowInTopLevel {
+			extra += ", top-level"
+		}
+		if args.Sizes {
+			extra += fmt.Sprintf(", %s", asset.Size)
+		}
+		switch {
+		case args.Media && asset.Media != nil:
+			extra += fmt.Sprintf(", %s", asset.Media)
+		case args.Durations:
+			extra += fmt.Sprintf(", %s", asset.Dur)
+		}
+		fmt.Printf("%3d: %s (%s%s)\n", i+1, asset.String(), asset.ShotID, extra)
+		if args.Verbose {
+			for _, key := range slices.Sorted(maps.Keys(asset.Variants)) {
+				sel := " "
+				if key == asset.VariantKey {
+					sel = "*"
+				}
+				fmt.Printf("   %s %s: %s\n", sel, key, asset.Variants[key])
+			}
+		}
+		if args.Verbose && asset.Media != nil {
+			for _, track := range asset.Media.Tracks {
+				fmt.Printf("     %d: %s %s %dx%d %.3gfps %s (%d/%d/%d) %s\n",
+					track.ID, track.Handler, track.Codec,
+					int(track.Width), int(track.Height), track.FrameRate,
+					track.TransferName(), track.Primaries, track.Transfer, track.Matrix,
+					track.Duration,
+				)
+			}
+		}
+		total += asset.Size
+	}
+	if args.Sizes {
+		fmt.Println("total:", total)
+	}
+}
+
+// writeExport writes the assets and their media info as json to the export
+// file.
+func (args *Args) writeExport(entries *Entries) error {
+	if args.Export == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(newRecords(entries), "", "  ")
+	if err != nil {
+		return err
+	}
+	u, err := user.Current()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(expand(u, args.Export), append(buf, '\n'), 0o644)
+}
+
+// buildUserAgent builds the user agent.
+func (args *Args) buildUserAgent(ctx context.Context) error {
+	if args.UserAgent != "" {
+		return nil
+	}
+	c, _ := ox.Ctx(ctx)
+	cache, err := newDiskCache(c.Root.Name, http.DefaultTransport.(*http.Transport).Clone())
+	if err != nil {
+		return err
+	}
+	args.UserAgent, err = verhist.UserAgent(
+		ctx,
+		verhist.PlatformString(),
+		verhist.Stable.String(),
+		verhist.WithTransport(cache),
+	)
+	return err
+}
+
+// init initializes the ca certs using during http requests.
+func (args *Args) init() error {
+	caCertsOnce.Do(func() {
+		if caCerts, args.err = x509.SystemCertPool(); args.err != nil {
+			return
+		}
+		if ok := caCerts.AppendCertsFromPEM(appleCABundlePEM); !ok {
+			args.err = errors.New("unable to append apple_ca_bundle.pem to system certs")
+			return
+		}
+	})
+	return args.err
+}
+
+// client returns the http client using the shared cache.
+func (args *Args) client(ctx context.Context, cache bool) (*http.Client, error) {
+	if err := args.init(); err != nil {
+		return nil, err
+	}
+	var transport http.RoundTripper = http.DefaultTransport.(*http.Transport).Clone()
+	transport.(*http.Transport).TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: false,
+		RootCAs:            caCerts,
+	}
+	if cache {
+		if args.Verbose {
 			transport = httplog.NewPrefixedRoundTripLogger(
 				transport,
 				args.logger,
@@ -629,13 +1780,59 @@ func (args *Args) get(ctx context.Context, urlstr string) (io.ReadCloser, error)
 	if err != nil {
 		return nil, err
 	}
-	res, err := cl.Do(req)
+	res, _, err := args.do(cl, req)
 	if err != nil {
 		return nil, err
 	}
 	return res.Body, nil
 }
 
+// do executes the request, retrying transient errors and retryable status
+// codes with exponential backoff. Returns the response and the number of
+// retries. The request must not have a body.
+func (args *Args) do(cl *http.Client, req *http.Request) (*http.Response, int, error) {
+	ctx := req.Context()
+	for retries := 0; ; retries++ {
+		res, err := cl.Do(req.Clone(ctx))
+		switch {
+		case retries >= args.Retries:
+			return res, retries, err
+		case err != nil && !retryable(ctx, err):
+			return nil, retries, err
+		case err == nil && !retryableStatus(res.StatusCode):
+			return res, retries, nil
+		}
+		d := args.backoff(retries+1, res)
+		if err == nil {
+			_ = res.Body.Close()
+			err = &statusError{method: req.Method, urlstr: req.URL.String(), code: res.StatusCode, status: res.Status}
+		}
+		args.logger("%s %s: retry %d/%d in %s: %v", req.Method, req.URL, retries+1, args.Retries, d, err)
+		if err := sleep(ctx, d); err != nil {
+			return nil, retries, err
+		}
+	}
+}
+
+// backoff returns the duration to wait before the retry, honoring the
+// response's Retry-After header when present, up to the maximum backoff.
+func (args *Args) backoff(retry int, res *http.Response) time.Duration {
+	if res != nil {
+		if d, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			return min(d, maxBackoff)
+		}
+	}
+	d := maxBackoff
+	if retry < 16 {
+		d = min(args.retryBackoff<<max(retry-1, 0), maxBackoff)
+	}
+	if d <= 0 {
+		return 0
+	}
+	// add jitter
+	return d + rand.N(d/4+1)
+}
+
 func (args *Args) getAll(ctx context.Context, urlstr string) ([]byte, error) {
 	body, err := args.get(ctx, urlstr)
 	if err != nil {
@@ -645,28 +1842,338 @@ func (args *Args) getAll(ctx context.Context, urlstr string) ([]byte, error) {
 	return io.ReadAll(body)
 }
 
-// getResURL gets the resources url.
+// getResURL gets the resources url, resolving the latest version when the
+// macOS version is "latest".
 func (args *Args) getResURL(ctx context.Context) error {
 	if args.resURL != "" {
 		return nil
 	}
-	version := nonNumRE.ReplaceAllString(strings.TrimPrefix(strings.ToLower(args.MacOSVersion), "v"), "-")
-	buf, err := args.getAll(ctx, fmt.Sprintf(resourcesConfigPlistURL, version))
+	if strings.EqualFold(args.MacOSVersion, "latest") {
+		versions, err := args.getVersions(ctx)
+		switch {
+		case err != nil:
+			return err
+		case len(versions) == 0:
+			return errors.New("no macOS versions with resources available")
+		}
+		v := versions[len(versions)-1]
+		args.logger("latest: %s", v.Version)
+		args.MacOSVersion, args.resURL = v.Version, v.ResourcesURL
+		return nil
+	}
+	buf, err := args.getAll(ctx, configURL(args.MacOSVersion))
 	if err != nil {
 		return err
 	}
+	args.resURL, err = parseResURL(buf)
+	return err
+}
+
+// getVersions gets the macOS versions with available resources, in order.
+// The versions are cached for a day, unless any version failed to be probed.
+func (args *Args) getVersions(ctx context.Context) ([]Version, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	c, _ := ox.Ctx(ctx)
+	name := filepath.Join(dir, c.Root.Name, versionsFile)
+	var cache struct {
+		Time     time.Time `json:"time"`
+		Versions []Version `json:"versions"`
+	}
+	if buf, err := os.ReadFile(name); err == nil && json.Unmarshal(buf, &cache) == nil && time.Since(cache.Time) < versionsTTL {
+		args.logger("versions: using cached %s", name)
+		return cache.Versions, nil
+	}
+	// probe past the last known good version
+	last := defaultMacOSVersion
+	if len(cache.Versions) != 0 {
+		last = cache.Versions[len(cache.Versions)-1].Version
+	}
+	versions, err := args.probeVersions(ctx, majorVersion(last)+aheadMajorVersions)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return nil, err
+	case err != nil:
+		// incomplete results are not cached
+		args.warn("warning: %v", err)
+		switch {
+		case len(versions) != 0:
+			return versions, nil
+		case len(cache.Versions) != 0:
+			return cache.Versions, nil
+		}
+		return nil, err
+	case len(versions) == 0:
+		return cache.Versions, nil
+	}
+	cache.Time, cache.Versions = time.Now(), versions
+	buf, err := json.Marshal(cache)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(name, buf, 0o644); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// probeVersions concurrently probes the resources config plists of the
+// candidate macOS versions, from the minimum major version up to the end
+// major version, returning the available versions in order. Versions that
+// fail to be retrieved are not included, and an error describing the
+// failures is returned along with the available versions.
+func (args *Args) probeVersions(ctx context.Context, end int) ([]Version, error) {
+	cl, err := args.client(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	var versions []Version
+	for major := minMajorVersion; major <= end; major++ {
+		for minor := range maxMinorVersion + 1 {
+			versions = append(versions, Version{Version: fmt.Sprintf("v%d.%d", major, minor)})
+		}
+	}
+	errs := make([]error, len(versions))
+	pool := pond.NewPool(args.Streams, pond.WithContext(ctx))
+	group := pool.NewGroup()
+	for i := range versions {
+		group.Submit(func() {
+			if versions[i].ResourcesURL, errs[i] = args.probeVersion(ctx, cl, versions[i].Version); errs[i] != nil {
+				args.logger("probe %s: %v", versions[i].Version, errs[i])
+			}
+		})
+	}
+	_ = group.Wait()
+	pool.StopAndWait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var n int
+	var first error
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			continue
+		case first == nil:
+			first = err
+		}
+		n++
+	}
+	versions = slices.DeleteFunc(versions, func(v Version) bool {
+		return v.ResourcesURL == ""
+	})
+	if n != 0 {
+		return versions, fmt.Errorf("%d of %d version probes failed: %w", n, len(errs), first)
+	}
+	return versions, nil
+}
+
+// majorVersion returns the major version of a macOS version (ie, 26 for
+// v26.0), or the major version of the default macOS version when invalid.
+func majorVersion(version string) int {
+	s, _, _ := strings.Cut(strings.TrimPrefix(strings.ToLower(version), "v"), ".")
+	if i, err := strconv.Atoi(s); err == nil {
+		return i
+	}
+	return majorVersion(defaultMacOSVersion)
+}
+
+// probeVersion retrieves the resources config plist for the version,
+// returning its resources url, or an empty string when not available.
+func (args *Args) probeVersion(ctx context.Context, cl *http.Client, version string) (string, error) {
+	req, err := args.newReq(ctx, "GET", configURL(version), nil)
+	if err != nil {
+		return "", err
+	}
+	res, _, err := args.do(cl, req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		args.logger("probe %s: %s", version, res.Status)
+		return "", nil
+	}
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	args.logger("probe %s: available", version)
+	return parseResURL(buf)
+}
+
+// Version is a macOS version with available resources.
+type Version struct {
+	Version      string `json:"version"`
+	ResourcesURL string `json:"resourcesURL"`
+}
+
+// configURL returns the resources config plist url for the macOS version.
+func configURL(version string) string {
+	version = nonNumRE.ReplaceAllString(strings.TrimPrefix(strings.ToLower(version), "v"), "-")
+	return fmt.Sprintf(resourcesConfigPlistURL, version)
+}
+
+// parseResURL parses the resources url from a resources config plist.
+func parseResURL(buf []byte) (string, error) {
 	var v struct {
 		ResourcesURL string `plist:"resources-url"`
 	}
 	if err := plist.Unmarshal(buf, &v); err != nil {
-		return err
+		return "", err
 	}
-	args.resURL = v.ResourcesURL
-	return nil
+	return v.ResourcesURL, nil
 }
 
 var nonNumRE = regexp.MustCompile(`[^0-9]`)
 
+// Resources is a resources bundle read into memory.
+type Resources struct {
+	files map[string][]byte
+}
+
+// ReadResources reads the resources bundle tar from r.
+func ReadResources(r io.Reader) (*Resources, error) {
+	res := &Resources{
+		files: make(map[string][]byte),
+	}
+	for tr := tar.NewReader(r); ; {
+		switch h, err := tr.Next(); {
+		case errors.Is(err, io.EOF):
+			return res, nil
+		case err != nil:
+			return nil, err
+		case h.Typeflag == tar.TypeReg:
+			buf, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			res.files[path.Clean(strings.TrimPrefix(h.Name, "./"))] = buf
+		}
+	}
+}
+
+// Names returns the sorted file names in the bundle.
+func (res *Resources) Names() []string {
+	return slices.Sorted(maps.Keys(res.files))
+}
+
+// File returns the named file in the bundle.
+func (res *Resources) File(name string) ([]byte, error) {
+	buf, ok := res.files[path.Clean(strings.TrimPrefix(name, "./"))]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	return buf, nil
+}
+
+// Entries decodes the bundle's entries.json. Unknown fields are preserved,
+// see [Entries.Unknown].
+func (res *Resources) Entries() (*Entries, error) {
+	buf, err := res.File(entriesJSON)
+	if err != nil {
+		return nil, err
+	}
+	entries := new(Entries)
+	if err := json.Unmarshal(buf, entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Langs returns the sorted languages having a string table in the bundle.
+func (res *Resources) Langs() []string {
+	var langs []string
+	for name := range res.files {
+		if s, ok := strings.CutPrefix(name, stringsBundle+"/"); ok {
+			if lang, ok := strings.CutSuffix(s, ".lproj/"+stringsFile); ok {
+				langs = append(langs, lang)
+			}
+		}
+	}
+	slices.Sort(langs)
+	return langs
+}
+
+// FindLang finds the language in the resources bundle, comparing
+// case-insensitively and treating '-' and '_' as equivalent.
+func (res *Resources) FindLang(lang string) (string, bool) {
+	key := strings.ReplaceAll(lang, "-", "_")
+	for _, name := range res.Langs() {
+		if strings.EqualFold(strings.ReplaceAll(name, "-", "_"), key) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// LocaleLangs returns the language fallback chain for a POSIX locale name
+// (ie, "zh_CN.UTF-8"), mapped onto the languages in the resources bundle.
+// The chain always ends with English.
+func (res *Resources) LocaleLangs(locale string) []string {
+	var langs []string
+	add := func(lang string) {
+		if lang != "" && !slices.Contains(langs, lang) {
+			langs = append(langs, lang)
+		}
+	}
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	if locale != "" && locale != "C" && locale != "POSIX" {
+		// exact match
+		if lang, ok := res.FindLang(locale); ok {
+			add(lang)
+		}
+		// closest match (ie, zh_CN -> zh-Hans, en_GB -> en)
+		if tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-")); err == nil {
+			var names []string
+			var tags []language.Tag
+			for _, name := range res.Langs() {
+				if t, err := language.Parse(strings.ReplaceAll(name, "_", "-")); err == nil {
+					names, tags = append(names, name), append(tags, t)
+				}
+			}
+			if len(tags) != 0 {
+				if _, i, c := language.NewMatcher(tags).Match(tag); c != language.No {
+					add(names[i])
+				}
+			}
+			// base language
+			if base, c := tag.Base(); c != language.No {
+				if lang, ok := res.FindLang(base.String()); ok {
+					add(lang)
+				}
+			}
+		}
+	}
+	add("en")
+	return langs
+}
+
+// Strings decodes the string table for the language, collapsing whitespace
+// and non-printable characters in values.
+func (res *Resources) Strings(lang string) (map[string]string, error) {
+	buf, err := res.File(stringsBundle + "/" + lang + ".lproj/" + stringsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not find plist for language %s", lang)
+	}
+	m := make(map[string]string)
+	if err := plist.Unmarshal(buf, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range m {
+		m[k] = strings.Join(strings.FieldsFunc(v, func(r rune) bool {
+			return unicode.IsSpace(r) || !unicode.IsPrint(r)
+		}), " ")
+	}
+	return m, nil
+}
+
 // Entries is the top level container for entries.json.
 type Entries struct {
 	Version             int        `json:"version"`
@@ -674,6 +2181,65 @@ type Entries struct {
 	Assets              []Asset    `json:"assets"`
 	InitialAssetCount   int        `json:"initialAssetCount"`
 	Categories          []Category `json:"categories"`
+
+	// unknown fields
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON satisfies the [json.Unmarshaler] interface.
+func (entries *Entries) UnmarshalJSON(buf []byte) error {
+	type entriesT Entries
+	var v entriesT
+	extra, err := unmarshalExtra(buf, &v)
+	if err != nil {
+		return err
+	}
+	*entries = Entries(v)
+	entries.Extra = extra
+	return nil
+}
+
+// Unknown returns the paths of all unknown fields in the entries.
+func (entries *Entries) Unknown() []string {
+	var paths []string
+	add := func(prefix string, extra map[string]json.RawMessage) {
+		for _, k := range slices.Sorted(maps.Keys(extra)) {
+			paths = append(paths, prefix+k)
+		}
+	}
+	add("", entries.Extra)
+	for i, asset := range entries.Assets {
+		add(fmt.Sprintf("assets[%d](%s).", i, asset.ShotID), asset.Extra)
+	}
+	for i, category := range entries.Categories {
+		add(fmt.Sprintf("categories[%d].", i), category.Extra)
+		for j, subcategory := range category.Subcategories {
+			add(fmt.Sprintf("categories[%d].subcategories[%d].", i, j), subcategory.Extra)
+		}
+	}
+	return paths
+}
+
+// Keys returns the localized name and description keys used by the entries.
+func (entries *Entries) Keys() []string {
+	m := make(map[string]bool)
+	add := func(keys ...string) {
+		for _, key := range keys {
+			if key != "" {
+				m[key] = true
+			}
+		}
+	}
+	for _, asset := range entries.Assets {
+		add(asset.LocalizedNameKey)
+	}
+	for _, category := range entries.Categories {
+		add(category.LocalizedNameKey, category.LocalizedDescriptionKey)
+		for _, subcategory := range category.Subcategories {
+			add(subcategory.LocalizedNameKey, subcategory.LocalizedDescriptionKey)
+		}
+	}
+	return slices.Sorted(maps.Keys(m))
 }
 
 func (entries *Entries) GetCategory(id string) string {
@@ -711,30 +2277,361 @@ type Asset struct {
 	PreviewImage        string            `json:"previewImage"`
 	PreviewImage900x580 string            `json:"previewImage-900x580"`
 	IncludeInShuffle    bool              `json:"includeInShuffle"`
-	URL4kSdr240FPS      string            `json:"url-4K-SDR-240FPS"`
 	Subcategories       []string          `json:"subcategories"`
 	PreferredOrder      int               `json:"preferredOrder"`
 	Categories          []string          `json:"categories"`
 	Group               string            `json:"group"`
 
+	// stream variants (url-* keys)
+	Variants map[string]string `json:"-"`
+
+	// unknown fields
+	Extra map[string]json.RawMessage `json:"-"`
+
+	// selected variant
+	VariantKey string `json:"-"`
+	URL        string `json:"-"`
+
+	// path built from the name template
+	Path string `json:"-"`
+
 	// names
 	Name             string   `json:"-"`
 	CategoryNames    []string `json:"-"`
 	SubcategoryNames []string `json:"-"`
 
 	// state fields (not in json)
-	Size ox.Size       `json:"-"`
-	Out  string        `json:"-"`
-	DL   bool          `json:"-"`
-	Dur  time.Duration `json:"-"`
-}
-
-func (a Asset) Names() []string {
-	return append(a.CategoryNames, append(a.SubcategoryNames, a.Name)...)
+	Size         ox.Size       `json:"-"`
+	ETag         string        `json:"-"`
+	LastModified string        `json:"-"`
+	Out          string        `json:"-"`
+	DL           bool          `json:"-"`
+	Offset       ox.Size       `json:"-"`
+	SHA256       string        `json:"-"`
+	Dur          time.Duration `json:"-"`
+	Media        *MovInfo      `json:"-"`
+	MediaErr     string        `json:"-"`
+	Err          error         `json:"-"`
 }
 
-func (a Asset) String() string {
-	return strings.Join(a.Names(), "/") + path.Ext(a.URL4kSdr240FPS)
+// UnmarshalJSON satisfies the [json.Unmarshaler] interface, collecting all
+// stream variant urls (url-* keys) into the asset's variants.
+func (a *Asset) UnmarshalJSON(buf []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return err
+	}
+	variants := make(map[string]string)
+	for k, v := range m {
+		if !strings.HasPrefix(k, variantPrefix) {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		variants[k] = s
+		delete(m, k)
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	type asset Asset
+	var v asset
+	extra, err := unmarshalExtra(buf, &v)
+	if err != nil {
+		return err
+	}
+	*a = Asset(v)
+	a.Variants, a.Extra = variants, extra
+	return nil
+}
+
+func (a Asset) Names() []string {
+	return append(a.CategoryNames, append(a.SubcategoryNames, a.Name)...)
+}
+
+// String satisfies the [fmt.Stringer] interface, returning the asset's path
+// relative to the destination.
+func (a Asset) String() string {
+	if a.Path != "" {
+		return a.Path
+	}
+	return strings.Join(a.Names(), "/") + a.Ext()
+}
+
+// Ext returns the file extension of the asset's url.
+func (a Asset) Ext() string {
+	return path.Ext(a.URL)
+}
+
+// Key returns the manifest key for the asset.
+func (a Asset) Key() string {
+	if a.ID != "" {
+		return a.ID
+	}
+	return a.ShotID
+}
+
+// Part returns the name of the partial download file for the asset.
+func (a Asset) Part() string {
+	return a.Out + partExt
+}
+
+// Validator returns the validator for the asset suitable for use with an
+// If-Range header. Only strong etags can be used with If-Range, otherwise
+// falls back to the last modified time.
+func (a Asset) Validator() string {
+	if a.ETag != "" && !strings.HasPrefix(a.ETag, "W/") {
+		return a.ETag
+	}
+	return a.LastModified
+}
+
+// LangInfo is the exported representation of a language in the resources
+// bundle, used for the langs output.
+type LangInfo struct {
+	Lang        string   `json:"lang"`
+	Name        string   `json:"name"`
+	EnglishName string   `json:"englishName"`
+	Keys        int      `json:"keys"`
+	Used        int      `json:"used"`
+	Translated  int      `json:"translated"`
+	Coverage    float64  `json:"coverage"`
+	Missing     []string `json:"missing,omitempty"`
+}
+
+// newLangInfo creates the language info for the strings of a language,
+// using the keys used by the entries to determine coverage.
+func newLangInfo(lang string, m map[string]string, keys []string) LangInfo {
+	info := LangInfo{
+		Lang: lang,
+		Keys: len(m),
+		Used: len(keys),
+	}
+	if tag, err := language.Parse(strings.ReplaceAll(lang, "_", "-")); err == nil {
+		info.Name = display.Self.Name(tag)
+		info.EnglishName = display.English.Tags().Name(tag)
+	}
+	for _, key := range keys {
+		if m[key] != "" {
+			info.Translated++
+		} else {
+			info.Missing = append(info.Missing, key)
+		}
+	}
+	if info.Used != 0 {
+		info.Coverage = math.Round(1000*float64(info.Translated)/float64(info.Used)) / 10
+	}
+	return info
+}
+
+// Record is the exported representation of an asset, used for json and csv
+// output.
+type Record struct {
+	ID                  string            `json:"id"`
+	ShotID              string            `json:"shotID"`
+	Name                string            `json:"name"`
+	Path                string            `json:"path"`
+	LocalizedNameKey    string            `json:"localizedNameKey"`
+	AccessibilityLabel  string            `json:"accessibilityLabel"`
+	Categories          []string          `json:"categories"`
+	CategoryNames       []string          `json:"categoryNames"`
+	Subcategories       []string          `json:"subcategories"`
+	SubcategoryNames    []string          `json:"subcategoryNames"`
+	Group               string            `json:"group"`
+	PreferredOrder      int               `json:"preferredOrder"`
+	IncludeInShuffle    bool              `json:"includeInShuffle"`
+	ShowInTopLevel      bool              `json:"showInTopLevel"`
+	Variant             string            `json:"variant"`
+	URL                 string            `json:"url"`
+	Variants            map[string]string `json:"variants"`
+	PreviewImage        string            `json:"previewImage"`
+	PreviewImage900x580 string            `json:"previewImage900x580"`
+	PointsOfInterest    map[string]string `json:"pointsOfInterest"`
+	Size                int64             `json:"size,omitempty"`
+	Duration            float64           `json:"duration,omitempty"`
+	Media               *MovInfo          `json:"media,omitempty"`
+}
+
+// newRecords creates records for the assets.
+func newRecords(entries *Entries) []Record {
+	v := make([]Record, 0, len(entries.Assets))
+	for _, asset := range entries.Assets {
+		v = append(v, Record{
+			ID:                  asset.ID,
+			ShotID:              asset.ShotID,
+			Name:                asset.Name,
+			Path:                asset.String(),
+			LocalizedNameKey:    asset.LocalizedNameKey,
+			AccessibilityLabel:  asset.AccessibilityLabel,
+			Categories:          asset.Categories,
+			CategoryNames:       asset.CategoryNames,
+			Subcategories:       asset.Subcategories,
+			SubcategoryNames:    asset.SubcategoryNames,
+			Group:               asset.Group,
+			PreferredOrder:      asset.PreferredOrder,
+			IncludeInShuffle:    asset.IncludeInShuffle,
+			ShowInTopLevel:      asset.ShowInTopLevel,
+			Variant:             asset.VariantKey,
+			URL:                 asset.URL,
+			Variants:            asset.Variants,
+			PreviewImage:        asset.PreviewImage,
+			PreviewImage900x580: asset.PreviewImage900x580,
+			PointsOfInterest:    asset.PointsOfInterest,
+			Size:                int64(asset.Size),
+			Duration:            asset.Dur.Seconds(),
+			Media:               asset.Media,
+		})
+	}
+	return v
+}
+
+// writeRecords writes the assets as delimited records with a header.
+// Multiple values are joined with a '|'.
+func writeRecords(w io.Writer, comma rune, entries *Entries) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(recordHeader); err != nil {
+		return err
+	}
+	join := func(v []string) string {
+		return strings.Join(v, "|")
+	}
+	joinMap := func(m map[string]string) string {
+		var v []string
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			v = append(v, k+"="+m[k])
+		}
+		return join(v)
+	}
+	for _, r := range newRecords(entries) {
+		var size, dur, media string
+		if r.Size != 0 {
+			size = strconv.FormatInt(r.Size, 10)
+		}
+		if r.Duration != 0 {
+			dur = strconv.FormatFloat(r.Duration, 'f', -1, 64)
+		}
+		if r.Media != nil {
+			media = r.Media.String()
+		}
+		err := cw.Write([]string{
+			r.ID,
+			r.ShotID,
+			r.Name,
+			r.Path,
+			r.LocalizedNameKey,
+			r.AccessibilityLabel,
+			join(r.Categories),
+			join(r.CategoryNames),
+			join(r.Subcategories),
+			join(r.SubcategoryNames),
+			r.Group,
+			strconv.Itoa(r.PreferredOrder),
+			strconv.FormatBool(r.IncludeInShuffle),
+			strconv.FormatBool(r.ShowInTopLevel),
+			r.Variant,
+			r.URL,
+			joinMap(r.Variants),
+			r.PreviewImage,
+			r.PreviewImage900x580,
+			joinMap(r.PointsOfInterest),
+			size,
+			dur,
+			media,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// recordHeader is the header for delimited records.
+var recordHeader = []string{
+	"id",
+	"shotID",
+	"name",
+	"path",
+	"localizedNameKey",
+	"accessibilityLabel",
+	"categories",
+	"categoryNames",
+	"subcategories",
+	"subcategoryNames",
+	"group",
+	"preferredOrder",
+	"includeInShuffle",
+	"showInTopLevel",
+	"variant",
+	"url",
+	"variants",
+	"previewImage",
+	"previewImage900x580",
+	"pointsOfInterest",
+	"size",
+	"duration",
+	"media",
+}
+
+// Variant is a parsed stream variant key (ie, url-4K-SDR-240FPS).
+type Variant struct {
+	Key    string
+	Height int
+	HDR    bool
+	Codec  string
+	FPS    int
+}
+
+// ParseVariant parses a stream variant key.
+func ParseVariant(key string) Variant {
+	v := Variant{
+		Key: key,
+	}
+	for s := range strings.SplitSeq(strings.TrimPrefix(key, variantPrefix), "-") {
+		switch u := strings.ToUpper(s); {
+		case u == "HDR":
+			v.HDR = true
+		case u == "SDR":
+		case strings.HasSuffix(u, "FPS"):
+			v.FPS, _ = strconv.Atoi(strings.TrimSuffix(u, "FPS"))
+		default:
+			if height, err := parseRes(u); err == nil && height != 0 {
+				v.Height = height
+			} else {
+				v.Codec = s
+			}
+		}
+	}
+	return v
+}
+
+// Is returns true when s is the variant's key, with or without the url-
+// prefix.
+func (v Variant) Is(s string) bool {
+	return strings.EqualFold(v.Key, s) || strings.EqualFold(v.Key, variantPrefix+s)
+}
+
+// parseRes parses a resolution (ie, 1080, 1080p, 4K), returning its height.
+func parseRes(s string) (int, error) {
+	switch u := strings.TrimSuffix(strings.ToUpper(s), "P"); u {
+	case "":
+		return 0, nil
+	case "4K", "UHD":
+		return 2160, nil
+	case "8K":
+		return 4320, nil
+	case "HD":
+		return 1080, nil
+	default:
+		if i, err := strconv.Atoi(u); err == nil && 0 < i {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid resolution %q", s)
 }
 
 // Category contains category information for entries.json.
@@ -746,6 +2643,22 @@ type Category struct {
 	Subcategories           []Subcategory `json:"subcategories"`
 	LocalizedDescriptionKey string        `json:"localizedDescriptionKey"`
 	PreviewImage            string        `json:"previewImage"`
+
+	// unknown fields
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON satisfies the [json.Unmarshaler] interface.
+func (category *Category) UnmarshalJSON(buf []byte) error {
+	type categoryT Category
+	var v categoryT
+	extra, err := unmarshalExtra(buf, &v)
+	if err != nil {
+		return err
+	}
+	*category = Category(v)
+	category.Extra = extra
+	return nil
 }
 
 // Subcategory contains subcategory information for entries.json.
@@ -756,6 +2669,50 @@ type Subcategory struct {
 	PreferredOrder          int    `json:"preferredOrder"`
 	LocalizedDescriptionKey string `json:"localizedDescriptionKey"`
 	RepresentativeAssetID   string `json:"representativeAssetID"`
+
+	// unknown fields
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON satisfies the [json.Unmarshaler] interface.
+func (subcategory *Subcategory) UnmarshalJSON(buf []byte) error {
+	type subcategoryT Subcategory
+	var v subcategoryT
+	extra, err := unmarshalExtra(buf, &v)
+	if err != nil {
+		return err
+	}
+	*subcategory = Subcategory(v)
+	subcategory.Extra = extra
+	return nil
+}
+
+// unmarshalExtra unmarshals buf into v, a pointer to a struct, returning any
+// fields in buf not known to v.
+func unmarshalExtra(buf []byte, v any) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(buf, v); err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, err
+	}
+	typ := reflect.TypeOf(v).Elem()
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		for k := range m {
+			if strings.EqualFold(k, name) {
+				delete(m, k)
+			}
+		}
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return m, nil
 }
 
 // newDiskCache creates the a new disk cache.
@@ -764,7 +2721,7 @@ func newDiskCache(name string, transport http.RoundTripper) (http.RoundTripper,
 		diskcache.WithAppCacheDir(name),
 		diskcache.WithMethod("GET", "HEAD"),
 		diskcache.WithTTL(30*24*time.Hour),
-		diskcache.WithHeaderWhitelist("Date", "Content-Type", "Content-Length"),
+		diskcache.WithHeaderWhitelist("Date", "Content-Type", "Content-Length", "ETag", "Last-Modified"),
 		diskcache.WithErrorTruncator(),
 		diskcache.WithGzipCompression(),
 		diskcache.WithTransport(transport),
@@ -785,6 +2742,450 @@ func expand(u *user.User, name string) string {
 	return name
 }
 
+// findStale finds media files in the base directory that are not in the
+// catalog assets, returning the file names and sizes. Skips the trash
+// directory.
+func findStale(baseDir, trashDir string, assets []Asset) (map[string]ox.Size, error) {
+	exts, keep := make(map[string]bool), make(map[string]bool)
+	for _, asset := range assets {
+		exts[path.Ext(asset.URL)] = true
+		keep[filepath.Join(baseDir, asset.String())] = true
+	}
+	stale := make(map[string]ox.Size)
+	err := filepath.WalkDir(baseDir, func(name string, d os.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir() && trashDir != "" && name == trashDir:
+			return filepath.SkipDir
+		case d.IsDir(), keep[name], !exts[filepath.Ext(name)]:
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stale[name] = ox.Size(fi.Size())
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return stale, err
+}
+
+// moveFile moves the file, copying and removing it when the destination is
+// on a different filesystem.
+func moveFile(from, to string) error {
+	err := os.Rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(from, to); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// copyFile copies the file, preserving its permissions and modification
+// time. The destination must not exist.
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(to)
+		return err
+	}
+	return os.Chtimes(to, fi.ModTime(), fi.ModTime())
+}
+
+// removeEmpty removes dir and its parents up to (but not including) the base
+// directory, stopping at the first non-empty directory.
+func removeEmpty(baseDir, dir string) {
+	for ; dir != baseDir && strings.HasPrefix(dir, baseDir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// confirm prompts for confirmation on stdin.
+func confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// matchAny returns true when want is empty, or when any of the values is
+// (case insensitively) in want.
+func matchAny(want, values []string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, w := range want {
+		for _, v := range values {
+			if strings.EqualFold(w, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchGlobs returns true when any of the glob patterns (case insensitively)
+// match name, or one of name's parent directories.
+func matchGlobs(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for s := name; s != "." && s != "/" && s != ""; s = path.Dir(s) {
+			if ok, _ := path.Match(pattern, s); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fileSize returns the size of the named file, or 0 if it does not exist.
+func fileSize(name string) (ox.Size, error) {
+	switch fi, err := os.Stat(name); {
+	case errors.Is(err, os.ErrNotExist):
+		return 0, nil
+	case err != nil:
+		return 0, err
+	case fi.IsDir():
+		return 0, fmt.Errorf("%s is a directory", name)
+	default:
+		return ox.Size(fi.Size()), nil
+	}
+}
+
+// resumeOffset returns the offset to resume the partial download for the
+// asset from, or 0 when the partial download does not exist or its validator
+// does not match.
+func resumeOffset(asset Asset) (ox.Size, error) {
+	size, err := fileSize(asset.Part())
+	switch {
+	case err != nil:
+		return 0, err
+	case size == 0, size > asset.Size, asset.Validator() == "":
+		return 0, nil
+	}
+	switch buf, err := os.ReadFile(asset.Part() + resumeExt); {
+	case errors.Is(err, os.ErrNotExist):
+		return 0, nil
+	case err != nil:
+		return 0, err
+	case string(buf) != asset.Validator():
+		return 0, nil
+	}
+	return size, nil
+}
+
+// retryable returns true when err is a transient error: a timeout, a reset
+// or refused connection, or a truncated response. Other errors (ie, dns
+// failures, tls verification, redirect loops) are permanent.
+func retryable(ctx context.Context, err error) bool {
+	var statusErr *statusError
+	var netErr net.Error
+	switch {
+	case ctx.Err() != nil:
+		return false
+	case errors.As(err, &statusErr):
+		return retryableStatus(statusErr.code)
+	case errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED):
+		return true
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// retryableStatus returns true when the status code is transient (ie, 429 or
+// 5xx).
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || 500 <= code && code <= 599
+}
+
+// retryAfter parses a Retry-After header value, which is either a number of
+// seconds or a http date.
+func retryAfter(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if i, err := strconv.Atoi(s); err == nil && 0 <= i {
+		return time.Duration(i) * time.Second, true
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// sleep sleeps for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// rangeReader is a [io.ReaderAt] for a remote url, using range requests.
+type rangeReader struct {
+	ctx    context.Context
+	args   *Args
+	cl     *http.Client
+	urlstr string
+}
+
+// ReadAt satisfies the [io.ReaderAt] interface.
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	r.args.logger("GET %s (range: %d-%d)", r.urlstr, off, off+int64(len(p))-1)
+	req, err := r.args.newReq(r.ctx, "GET", r.urlstr, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	res, _, err := r.args.do(r.cl, req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent {
+		return 0, &statusError{method: "GET", urlstr: r.urlstr, code: res.StatusCode, status: res.Status}
+	}
+	return io.ReadFull(res.Body, p)
+}
+
+// statusError is a http status error.
+type statusError struct {
+	method string
+	urlstr string
+	code   int
+	status string
+}
+
+// Error satisfies the [error] interface.
+func (err *statusError) Error() string {
+	return fmt.Sprintf("%s %s: %s", err.method, err.urlstr, err.status)
+}
+
+// buildPath builds the path for the asset using the name template. The
+// asset's names are cleaned before being passed to the template, and each
+// component of the resulting path is cleaned and truncated. The asset's
+// extension is added when missing.
+func (args *Args) buildPath(tpl *template.Template, asset Asset) (string, error) {
+	data := asset
+	data.Name = args.cleanName(asset.Name)
+	data.CategoryNames = args.cleanNames(asset.CategoryNames)
+	data.SubcategoryNames = args.cleanNames(asset.SubcategoryNames)
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	var v []string
+	for s := range strings.SplitSeq(buf.String(), "/") {
+		if s = args.cleanName(s); s != "" {
+			v = append(v, s)
+		}
+	}
+	ext := asset.Ext()
+	if len(v) != 0 {
+		v[len(v)-1] = strings.TrimSuffix(v[len(v)-1], ext)
+	}
+	if len(v) == 0 || v[len(v)-1] == "" {
+		return "", errors.New("name template produced an empty path")
+	}
+	for i := range v {
+		if i == len(v)-1 {
+			v[i] = args.truncName(v[i], ext)
+		} else {
+			v[i] = args.truncName(v[i], "")
+		}
+	}
+	return strings.Join(v, "/"), nil
+}
+
+// resolveCollisions resolves the paths of assets that collide using the
+// collision strategy, reporting the renamed assets. Paths are compared
+// case-insensitively, so assets whose names only collide after cleaning are
+// also resolved.
+func (args *Args) resolveCollisions(assets []Asset) error {
+	m := make(map[string][]int)
+	for i, asset := range assets {
+		k := strings.ToLower(asset.Path)
+		m[k] = append(m[k], i)
+	}
+	var renamed []string
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		v := m[k]
+		if len(v) < 2 {
+			continue
+		}
+		sort.Slice(v, func(i, j int) bool {
+			return assets[v[i]].ID < assets[v[j]].ID
+		})
+		suffixes := make([]string, len(v))
+		for n, i := range v {
+			switch args.Collision {
+			case "error":
+				return fmt.Errorf("%s is not unique: %q", assets[i].ShotID, assets[i].Path)
+			case "shot-id":
+				suffixes[n] = assets[i].ShotID
+			case "index":
+				suffixes[n] = strconv.Itoa(n + 1)
+			case "subcategory":
+				suffixes[n] = args.cleanName(strings.Join(assets[i].SubcategoryNames, " "))
+			default:
+				return fmt.Errorf("invalid collision strategy %q", args.Collision)
+			}
+		}
+		count := make(map[string]int)
+		for _, suffix := range suffixes {
+			count[suffix]++
+		}
+		for n, i := range v {
+			// fall back to the shot id when the suffix is empty or not unique
+			if suffixes[n] == "" || count[suffixes[n]] > 1 {
+				suffixes[n] = assets[i].ShotID
+			}
+		}
+		for n, i := range v {
+			p := args.addSuffix(assets[i].Path, " ("+suffixes[n]+")")
+			renamed = append(renamed, fmt.Sprintf("  %s -> %s (%s)", assets[i].Path, p, assets[i].ShotID))
+			assets[i].Path = p
+		}
+	}
+	if len(renamed) != 0 && !args.Quiet {
+		fmt.Fprintln(os.Stderr, "renamed colliding assets:")
+		for _, s := range renamed {
+			fmt.Fprintln(os.Stderr, s)
+		}
+	}
+	return nil
+}
+
+// addSuffix adds the suffix to the file name of the path, before its
+// extension.
+func (args *Args) addSuffix(p, suffix string) string {
+	dir, name := path.Split(p)
+	ext := path.Ext(name)
+	return dir + args.truncName(strings.TrimSuffix(name, ext), suffix+ext)
+}
+
+// cleanNames cleans the names.
+func (args *Args) cleanNames(names []string) []string {
+	v := make([]string, len(names))
+	for i, s := range names {
+		v[i] = args.cleanName(s)
+	}
+	return v
+}
+
+// cleanName cleans a path component, optionally transliterating it to
+// ascii, replacing separators, reserved and control characters, and removing
+// leading dots and surrounding spaces. Reserved Windows device names are
+// prefixed with an underscore.
+func (args *Args) cleanName(s string) string {
+	if args.ASCII {
+		s = toASCII(s)
+	}
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f, strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		case unicode.IsSpace(r):
+			return ' '
+		}
+		return r
+	}, s)
+	s = strings.TrimRight(strings.TrimLeft(strings.TrimSpace(s), "."), ". ")
+	base, _, _ := strings.Cut(s, ".")
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		s = "_" + s
+	}
+	return s
+}
+
+// truncName truncates the name so that the name and suffix fit within the
+// maximum component length, without splitting runes.
+func (args *Args) truncName(name, suffix string) string {
+	n := args.MaxNameLen - len(suffix)
+	if args.MaxNameLen <= 0 || len(name) <= n {
+		return name + suffix
+	}
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return strings.TrimRight(name[:max(n, 0)], ". ") + suffix
+}
+
+// toASCII transliterates s to ascii, removing diacritics and replacing
+// characters without an ascii equivalent with an underscore.
+func toASCII(s string) string {
+	s, _, _ = transform.String(transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn))), s)
+	var b strings.Builder
+	for _, r := range s {
+		switch str, ok := asciiNames[r]; {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case ok:
+			b.WriteString(str)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// contentRangeStart returns the start offset of a Content-Range header value
+// (ie, "bytes 100-199/200").
+func contentRangeStart(s string) (ox.Size, bool) {
+	s, ok := strings.CutPrefix(s, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	s, _, ok = strings.Cut(s, "-")
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return ox.Size(i), true
+}
+
 // ffprobeDuration uses ffprobe to determine the duration in seconds of a file.
 func ffprobeDuration(ctx context.Context, name string) (int64, error) {
 	ffprobeOnce.Do(func() {
@@ -822,12 +3223,96 @@ var (
 	ffprobeOnce sync.Once
 )
 
+// errNoFFprobe is the ffprobe not available error.
+var errNoFFprobe = errors.New("ffprobe not available")
+
 // ca bundle vars.
 var (
 	caCerts     *x509.CertPool
 	caCertsOnce sync.Once
 )
 
+// defaultNameTemplate is the default file name template.
+const defaultNameTemplate = `{{ join .Names "/" }}{{ .Ext }}`
+
+// nameFuncs are the funcs available to the name template.
+var nameFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"first": func(v []string) string {
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0]
+	},
+}
+
+// reservedNames are reserved Windows device names.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// asciiNames are ascii transliterations for characters that do not
+// decompose to ascii.
+var asciiNames = map[rune]string{
+	'ß': "ss", 'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe",
+	'Ø': "O", 'ø': "o", 'Ł': "L", 'ł': "l", 'Đ': "D", 'đ': "d",
+	'Ð': "D", 'ð': "d", 'Þ': "TH", 'þ': "th", 'ı': "i",
+	'‘': "'", '’': "'", '“': `"`, '”': `"`, '–': "-", '—': "-",
+}
+
+// variantPrefix is the prefix for stream variant keys in entries.json.
+const variantPrefix = "url-"
+
+// partial download extensions.
+const (
+	// partExt is the extension of a partial download.
+	partExt = ".part"
+	// resumeExt is the extension of the file storing the validator for a
+	// partial download.
+	resumeExt = ".resume"
+)
+
+// errAborted is the error used to abort remaining tasks.
+var errAborted = errors.New("aborted")
+
+// maxBackoff is the maximum retry backoff.
+const maxBackoff = 2 * time.Minute
+
+// resources bundle file names.
+const (
+	entriesJSON   = "entries.json"
+	stringsBundle = "TVIdleScreenStrings.bundle"
+	stringsFile   = "Localizable.nocache.strings"
+)
+
+// versionsFile is the name of the cached versions file.
+const versionsFile = "versions.json"
+
+// versionsTTL is how long the available versions are cached.
+const versionsTTL = 24 * time.Hour
+
+// defaultMacOSVersion is the default macOS version, and the version probing
+// starts from when there are no previously available versions.
+const defaultMacOSVersion = "v26.0"
+
+// bounds of the candidate macOS versions probed for available resources.
+const (
+	// minMajorVersion is the lowest major version probed.
+	minMajorVersion = 14
+	// maxMinorVersion is the highest minor version probed for each major
+	// version.
+	maxMinorVersion = 7
+	// aheadMajorVersions is the number of major versions probed past the last
+	// known good version.
+	aheadMajorVersions = 2
+)
+
 // resourcesConfigPlistURL is the resources config plist URL.
 const resourcesConfigPlistURL = "https://configuration.apple.com/configurations/internetservices/aerials/resources-config-%s.plist"
 
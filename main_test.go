@@ -0,0 +1,866 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xo/ox"
+)
+
+func TestRetryable(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com", Err: err}
+	}
+	tests := []struct {
+		err error
+		exp bool
+	}{
+		{urlErr(&net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}), false},
+		{urlErr(errors.New(`unsupported protocol scheme ""`)), false},
+		{urlErr(errors.New("stopped after 10 redirects")), false},
+		{urlErr(x509.UnknownAuthorityError{}), false},
+		{urlErr(os.ErrDeadlineExceeded), true},
+		{urlErr(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), true},
+		{urlErr(&net.OpError{Op: "read", Err: syscall.ECONNRESET}), true},
+		{fmt.Errorf("copy: %w", io.ErrUnexpectedEOF), true},
+		{&statusError{code: http.StatusServiceUnavailable}, true},
+		{&statusError{code: http.StatusTooManyRequests}, true},
+		{&statusError{code: http.StatusNotFound}, false},
+		{&statusError{code: http.StatusForbidden}, false},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			if b := retryable(context.Background(), test.err); b != test.exp {
+				t.Errorf("expected %t, got: %t (%v)", test.exp, b, test.err)
+			}
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if retryable(ctx, urlErr(os.ErrDeadlineExceeded)) {
+		t.Errorf("expected canceled context to not be retryable")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		s   string
+		exp time.Duration
+		ok  bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			d, ok := retryAfter(test.s)
+			if ok != test.ok || d != test.exp {
+				t.Errorf("expected %v/%t, got: %v/%t", test.exp, test.ok, d, ok)
+			}
+		})
+	}
+	d, ok := retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if !ok || d < 59*time.Minute || time.Hour < d {
+		t.Errorf("expected ~1h, got: %v/%t", d, ok)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	res := func(retryAfter string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{retryAfter}}}
+	}
+	tests := []struct {
+		name  string
+		retry int
+		res   *http.Response
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"first", 1, nil, time.Second, time.Second + time.Second/4},
+		{"second", 2, nil, 2 * time.Second, 2*time.Second + time.Second/2},
+		{"max", 20, nil, maxBackoff, maxBackoff + maxBackoff/4},
+		{"retry after", 1, res("30"), 30 * time.Second, 30 * time.Second},
+		{"retry after zero", 1, res("0"), 0, 0},
+		{"retry after day", 1, res("86400"), maxBackoff, maxBackoff},
+		{"retry after date", 1, res(time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat)), maxBackoff, maxBackoff},
+		{"retry after invalid", 1, res("soon"), time.Second, time.Second + time.Second/4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := &Args{retryBackoff: time.Second}
+			if d := args.backoff(test.retry, test.res); d < test.min || test.max < d {
+				t.Errorf("expected %v-%v, got: %v", test.min, test.max, d)
+			}
+		})
+	}
+}
+
+func TestParseVariant(t *testing.T) {
+	tests := []struct {
+		key string
+		exp Variant
+	}{
+		{"url-4K-SDR-240FPS", Variant{Key: "url-4K-SDR-240FPS", Height: 2160, FPS: 240}},
+		{"url-4K-HDR", Variant{Key: "url-4K-HDR", Height: 2160, HDR: true}},
+		{"url-1080-SDR", Variant{Key: "url-1080-SDR", Height: 1080}},
+		{"url-1080-H264", Variant{Key: "url-1080-H264", Height: 1080, Codec: "H264"}},
+		{"url-1080p-hdr-60fps", Variant{Key: "url-1080p-hdr-60fps", Height: 1080, HDR: true, FPS: 60}},
+		{"url-other", Variant{Key: "url-other", Codec: "other"}},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			if v := ParseVariant(test.key); v != test.exp {
+				t.Errorf("expected %+v, got: %+v", test.exp, v)
+			}
+		})
+	}
+}
+
+func TestSelectVariant(t *testing.T) {
+	variants := map[string]string{
+		"url-4K-SDR-240FPS": "a",
+		"url-4K-SDR":        "b",
+		"url-4K-HDR":        "c",
+		"url-1080-SDR":      "d",
+		"url-1080-H264":     "e",
+	}
+	tests := []struct {
+		variant   []string
+		maxHeight int
+		variants  map[string]string
+		exp       string
+	}{
+		{nil, 0, variants, "url-4K-SDR-240FPS"},
+		{nil, 1080, variants, "url-1080-SDR"},
+		{nil, 720, variants, "url-1080-SDR"},
+		{[]string{"4K-HDR"}, 0, variants, "url-4K-HDR"},
+		{[]string{"1080-H264", "4K-HDR"}, 0, variants, "url-1080-H264"},
+		{[]string{"4K-HDR"}, 1080, variants, "url-1080-SDR"},
+		{[]string{"1080-SDR"}, 0, map[string]string{"url-4K-SDR": "b"}, "url-4K-SDR"},
+		{nil, 0, nil, ""},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			args := &Args{Variant: test.variant, Quiet: true, logger: t.Logf}
+			asset := Asset{ShotID: "TEST", Variants: test.variants}
+			ok := args.selectVariant(&asset, test.maxHeight)
+			if ok != (test.exp != "") || asset.VariantKey != test.exp {
+				t.Errorf("expected %q, got: %q (%t)", test.exp, asset.VariantKey, ok)
+			}
+		})
+	}
+}
+
+func TestCheckVariants(t *testing.T) {
+	assets := []Asset{{Variants: map[string]string{"url-4K-SDR": "", "url-1080-SDR": ""}}}
+	for _, test := range []struct {
+		variant []string
+		ok      bool
+	}{
+		{nil, true},
+		{[]string{"4k-sdr"}, true},
+		{[]string{"url-1080-SDR"}, true},
+		{[]string{"4K-SDR", "1080-SRD"}, false},
+	} {
+		args := &Args{Variant: test.variant}
+		if err := args.checkVariants(assets); (err == nil) != test.ok {
+			t.Errorf("%v: expected ok %t, got: %v", test.variant, test.ok, err)
+		}
+	}
+}
+
+func TestResolveCollisions(t *testing.T) {
+	tests := []struct {
+		collision string
+		exp       []string
+		err       bool
+	}{
+		{"error", nil, true},
+		{"shot-id", []string{"Foo (B).mov", "foo (A).mov", "Bar.mov"}, false},
+		{"index", []string{"Foo (2).mov", "foo (1).mov", "Bar.mov"}, false},
+		{"subcategory", []string{"Foo (Night).mov", "foo (Day).mov", "Bar.mov"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.collision, func(t *testing.T) {
+			args := &Args{Collision: test.collision, MaxNameLen: 255, Quiet: true}
+			assets := []Asset{
+				{ID: "2", ShotID: "B", Path: "Foo.mov", SubcategoryNames: []string{"Night"}},
+				{ID: "1", ShotID: "A", Path: "foo.mov", SubcategoryNames: []string{"Day"}},
+				{ID: "3", ShotID: "C", Path: "Bar.mov"},
+			}
+			switch err := args.resolveCollisions(assets); {
+			case test.err && err == nil:
+				t.Fatalf("expected error")
+			case !test.err && err != nil:
+				t.Fatalf("expected no error, got: %v", err)
+			case test.err:
+				return
+			}
+			for i, asset := range assets {
+				if asset.Path != test.exp[i] {
+					t.Errorf("asset %d expected %q, got: %q", i, test.exp[i], asset.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		s     string
+		ascii bool
+		exp   string
+	}{
+		{"Los Angeles", false, "Los Angeles"},
+		{"Day/Night", false, "Day_Night"},
+		{`a\b:c*d?e"f<g>h|i`, false, "a_b_c_d_e_f_g_h_i"},
+		{"tab\there", false, "tab_here"},
+		{"no\u00a0break", false, "no break"},
+		{"bell\x07\x7f", false, "bell__"},
+		{"  ..hidden", false, "hidden"},
+		{"trailing. . ", false, "trailing"},
+		{"...", false, ""},
+		{"CON", false, "_CON"},
+		{"con.mov", false, "_con.mov"},
+		{"NUL .txt", false, "_NUL .txt"},
+		{"LPT9", false, "_LPT9"},
+		{"CONSOLE", false, "CONSOLE"},
+		{"COM0", false, "COM0"},
+		{"Île-de-France", false, "Île-de-France"},
+		{"Île-de-France", true, "Ile-de-France"},
+		{"Straße – Nord", true, "Strasse - Nord"},
+		{"東京", true, "__"},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			args := &Args{ASCII: test.ascii}
+			if s := args.cleanName(test.s); s != test.exp {
+				t.Errorf("expected %q, got: %q", test.exp, s)
+			}
+		})
+	}
+}
+
+func TestTruncName(t *testing.T) {
+	tests := []struct {
+		name   string
+		suffix string
+		max    int
+		exp    string
+	}{
+		{"abcdef", ".mov", 0, "abcdef.mov"},
+		{"abcdef", ".mov", 10, "abcdef.mov"},
+		{"abcdefg", ".mov", 10, "abcdef.mov"},
+		{"abc. def", ".mov", 8, "abc.mov"},
+		{"aé", "", 2, "a"},
+		{"aé", "", 3, "aé"},
+		{"東京", ".mov", 9, "東.mov"},
+		{"東京", ".mov", 6, ".mov"},
+		{"東京", " (A).mov", 4, " (A).mov"},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			args := &Args{MaxNameLen: test.max}
+			s := args.truncName(test.name, test.suffix)
+			if s != test.exp {
+				t.Errorf("expected %q, got: %q", test.exp, s)
+			}
+			if !utf8.ValidString(s) {
+				t.Errorf("expected valid utf-8, got: %q", s)
+			}
+		})
+	}
+}
+
+func TestBuildPath(t *testing.T) {
+	asset := Asset{
+		Name:             "Golden Gate/Bay",
+		CategoryNames:    []string{"Cityscape"},
+		SubcategoryNames: []string{"San Francisco"},
+		ShotID:           "SF_001",
+		URL:              "https://example.com/sf_001.mov",
+	}
+	tests := []struct {
+		tpl   string
+		ascii bool
+		max   int
+		exp   string
+		err   bool
+	}{
+		{defaultNameTemplate, false, 255, "Cityscape/San Francisco/Golden Gate_Bay.mov", false},
+		{`{{ .Name }}`, false, 255, "Golden Gate_Bay.mov", false},
+		{`{{ .Name }}.mov`, false, 255, "Golden Gate_Bay.mov", false},
+		{`{{ lower (first .CategoryNames) }}//{{ .ShotID }}`, false, 255, "cityscape/SF_001.mov", false},
+		{`{{ .ShotID }}/../{{ .Name }}`, false, 255, "SF_001/Golden Gate_Bay.mov", false},
+		{`{{ join .Names "/" }}`, false, 10, "Cityscape/San Franci/Golden.mov", false},
+		{`{{ .ShotID }}/Café`, true, 255, "SF_001/Cafe.mov", false},
+		{`{{ .Missing }}`, false, 255, "", true},
+		{`{{ "" }}`, false, 255, "", true},
+		{`{{ "/../" }}`, false, 255, "", true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			tpl, err := template.New("name").Funcs(nameFuncs).Parse(test.tpl)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			args := &Args{ASCII: test.ascii, MaxNameLen: test.max}
+			switch s, err := args.buildPath(tpl, asset); {
+			case test.err && err == nil:
+				t.Errorf("expected error, got: %q", s)
+			case !test.err && err != nil:
+				t.Errorf("expected no error, got: %v", err)
+			case s != test.exp:
+				t.Errorf("expected %q, got: %q", test.exp, s)
+			}
+		})
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	tests := []struct {
+		s   string
+		exp ox.Size
+		ok  bool
+	}{
+		{"", 0, false},
+		{"bytes 0-99/200", 0, true},
+		{"bytes 100-199/200", 100, true},
+		{"bytes 100-199/*", 100, true},
+		{"bytes */200", 0, false},
+		{"bytes -1-2/3", 0, false},
+		{"bytes x-199/200", 0, false},
+		{"100-199/200", 0, false},
+		{"items 100-199/200", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			i, ok := contentRangeStart(test.s)
+			if ok != test.ok || i != test.exp {
+				t.Errorf("expected %d/%t, got: %d/%t", test.exp, test.ok, i, ok)
+			}
+		})
+	}
+}
+
+func TestLocaleLangs(t *testing.T) {
+	res := &Resources{
+		files: make(map[string][]byte),
+	}
+	for _, lang := range []string{"de", "en", "en_AU", "en_GB", "es_419", "es", "fr", "fr_CA", "pt_BR", "pt_PT", "zh_CN", "zh_HK", "zh_TW"} {
+		res.files[stringsBundle+"/"+lang+".lproj/"+stringsFile] = nil
+	}
+	tests := []struct {
+		locale string
+		exp    []string
+	}{
+		{"", []string{"en"}},
+		{"C", []string{"en"}},
+		{"POSIX", []string{"en"}},
+		{"C.UTF-8", []string{"en"}},
+		{"en_US.UTF-8", []string{"en"}},
+		{"en_GB.UTF-8", []string{"en_GB", "en"}},
+		{"de_DE.UTF-8@euro", []string{"de", "en"}},
+		{"fr_CA", []string{"fr_CA", "fr", "en"}},
+		{"fr_BE.UTF-8", []string{"fr", "en"}},
+		{"es_MX.UTF-8", []string{"es_419", "es", "en"}},
+		{"pt_BR.UTF-8", []string{"pt_BR", "en"}},
+		{"zh_CN.UTF-8", []string{"zh_CN", "en"}},
+		{"zh_SG.UTF-8", []string{"zh_CN", "en"}},
+		{"ja_JP.UTF-8", []string{"en"}},
+		{"xx", []string{"en"}},
+	}
+	for _, test := range tests {
+		t.Run(test.locale, func(t *testing.T) {
+			if langs := res.LocaleLangs(test.locale); !slices.Equal(langs, test.exp) {
+				t.Errorf("expected %v, got: %v", test.exp, langs)
+			}
+		})
+	}
+}
+
+func TestSetDL(t *testing.T) {
+	tests := []struct {
+		name   string
+		prev   ManifestAsset
+		etag   string
+		mod    string
+		size   int
+		verify bool
+		exp    bool
+	}{
+		{"unchanged", ManifestAsset{ETag: `"old"`}, `"old"`, "", 10, false, false},
+		{"etag changed", ManifestAsset{ETag: `"old"`}, `"new"`, "", 10, false, true},
+		{"weak etag changed", ManifestAsset{ETag: `W/"old"`}, `W/"new"`, "", 10, false, true},
+		{"no etag", ManifestAsset{}, `"new"`, "", 10, false, false},
+		{"last modified unchanged", ManifestAsset{LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}, "", "Mon, 02 Jan 2006 15:04:05 GMT", 10, false, false},
+		{"last modified changed", ManifestAsset{LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}, "", "Tue, 03 Jan 2006 15:04:05 GMT", 10, false, true},
+		{"size changed", ManifestAsset{ETag: `"old"`}, `"old"`, "", 12, false, true},
+		{"checksum mismatch", ManifestAsset{ETag: `"old"`, SHA256: "bad"}, `"old"`, "", 10, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "Cat", "Foo.mov"), 10)
+			// a partial download of the new version
+			writeFile(t, filepath.Join(dir, "Cat", "Foo.mov"+partExt), 5)
+			prev := test.prev
+			prev.ID, prev.URL, prev.Size, prev.Path = "1", "https://example.com/foo.mov", 10, "Cat/Foo.mov"
+			writeManifest(t, dir, prev)
+			args := &Args{Dest: dir, Verify: test.verify, Quiet: true, logger: t.Logf}
+			asset := Asset{
+				ID:            "1",
+				ShotID:        "A",
+				Name:          "Foo",
+				CategoryNames: []string{"Cat"},
+				URL:           "https://example.com/foo.mov",
+				Size:          ox.Size(test.size),
+				ETag:          test.etag,
+				LastModified:  test.mod,
+			}
+			args.catalog = []Asset{asset}
+			entries := &Entries{Assets: []Asset{asset}}
+			if err := args.setDL(entries); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if asset := entries.Assets[0]; asset.DL != test.exp || asset.Offset != 0 {
+				t.Errorf("expected DL %t with offset 0, got: %t/%d", test.exp, asset.DL, asset.Offset)
+			}
+		})
+	}
+}
+
+// writeFile writes a file of the specified size, creating its parent
+// directories.
+func writeFile(t *testing.T, name string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := os.WriteFile(name, make([]byte, size), 0o644); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+// writeManifest writes a manifest with the assets to the directory.
+func writeManifest(t *testing.T, dir string, assets ...ManifestAsset) {
+	t.Helper()
+	m := &Manifest{
+		Version: manifestVersion,
+		Assets:  make(map[string]ManifestAsset),
+	}
+	for _, asset := range assets {
+		m.Assets[asset.ID] = asset
+	}
+	if err := m.Save(filepath.Join(dir, manifestName)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+func TestCheckManifestMediaErr(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		exp     string
+	}{
+		{"current", movVersion, "parse error"},
+		{"old parser", movVersion - 1, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "Foo.mov"), 10)
+			args := &Args{Quiet: true, logger: t.Logf}
+			args.manifest = &Manifest{
+				Assets: map[string]ManifestAsset{
+					"1": {ID: "1", URL: "https://example.com/foo.mov", Size: 10, Path: "Foo.mov", MediaErr: "parse error", MediaVersion: test.version},
+				},
+			}
+			asset := Asset{ID: "1", URL: "https://example.com/foo.mov", Size: 10, Out: filepath.Join(dir, "Foo.mov")}
+			switch ok, err := args.checkManifest(dir, &asset); {
+			case err != nil:
+				t.Fatalf("expected no error, got: %v", err)
+			case !ok:
+				t.Fatalf("expected manifest match")
+			case asset.MediaErr != test.exp:
+				t.Errorf("expected %q, got: %q", test.exp, asset.MediaErr)
+			}
+		})
+	}
+}
+
+func TestAddMediaMissing(t *testing.T) {
+	args := &Args{Quiet: true, logger: t.Logf}
+	asset := Asset{Out: filepath.Join(t.TempDir(), "missing.mov"), MediaErr: "previous"}
+	args.addMedia(context.Background(), &asset)
+	if asset.MediaErr != "" || asset.Media != nil {
+		t.Errorf("expected missing file to not be recorded, got: %q", asset.MediaErr)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	for _, trash := range []bool{false, true} {
+		t.Run(fmt.Sprintf("trash=%t", trash), func(t *testing.T) {
+			dir := t.TempDir()
+			dest, trashDir := filepath.Join(dir, "dest"), ""
+			if trash {
+				trashDir = filepath.Join(dir, "trash")
+			}
+			// 1 is in the catalog (ie, filtered out), 2 is no longer in the
+			// catalog, 3 is no longer in the catalog or on disk, and
+			// Other.mov is not managed
+			writeFile(t, filepath.Join(dest, "Cat", "A.mov"), 10)
+			writeFile(t, filepath.Join(dest, "Old", "B.mov"), 20)
+			writeFile(t, filepath.Join(dest, "Other.mov"), 30)
+			writeManifest(t, dest,
+				ManifestAsset{ID: "1", Size: 10, Path: "Cat/A.mov"},
+				ManifestAsset{ID: "2", Size: 20, Path: "Old/B.mov"},
+				ManifestAsset{ID: "3", Size: 40, Path: "Old/C.mov"},
+			)
+			m, err := LoadManifest(filepath.Join(dest, manifestName))
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			args := &Args{Dest: dest, Trash: trashDir, Yes: true, Quiet: true, logger: t.Logf}
+			args.catalog = []Asset{{ID: "1", Name: "A", CategoryNames: []string{"Cat"}, URL: "https://example.com/a.mov"}}
+			args.manifest = m
+			captureStdout(t, func() {
+				err = args.prune()
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			for _, name := range []string{"Cat/A.mov", "Other.mov"} {
+				if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+					t.Errorf("expected %s to be kept, got: %v", name, err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dest, "Old")); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected Old to be removed, got: %v", err)
+			}
+			if trash {
+				if size, err := fileSize(filepath.Join(trashDir, "Old", "B.mov")); err != nil || size != 20 {
+					t.Errorf("expected Old/B.mov in trash, got: %d %v", size, err)
+				}
+			}
+			m, err = LoadManifest(filepath.Join(dest, manifestName))
+			switch {
+			case err != nil:
+				t.Fatalf("expected no error, got: %v", err)
+			case len(m.Assets) != 2 || m.Assets["1"].ID == "" || m.Assets["3"].ID == "":
+				t.Errorf("expected manifest assets 1 and 3, got: %v", m.Assets)
+			}
+		})
+	}
+	args := &Args{Dest: t.TempDir(), Yes: true, Quiet: true, logger: t.Logf}
+	args.manifest = &Manifest{Assets: map[string]ManifestAsset{"1": {ID: "1"}}}
+	if err := args.prune(); err == nil {
+		t.Errorf("expected error for empty catalog")
+	}
+}
+
+func TestFindStale(t *testing.T) {
+	dir := t.TempDir()
+	trashDir := filepath.Join(dir, "trash")
+	for name, size := range map[string]int{
+		"Cat/A.mov":      10,
+		"Cat/B.mov":      20,
+		"Cat/B.mov.part": 5,
+		"notes.txt":      30,
+		"trash/C.mov":    40,
+	} {
+		writeFile(t, filepath.Join(dir, filepath.FromSlash(name)), size)
+	}
+	assets := []Asset{{Name: "A", CategoryNames: []string{"Cat"}, URL: "https://example.com/a.mov"}}
+	stale, err := findStale(dir, trashDir, assets)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	exp := map[string]ox.Size{filepath.Join(dir, "Cat", "B.mov"): 20}
+	if !maps.Equal(stale, exp) {
+		t.Errorf("expected %v, got: %v", exp, stale)
+	}
+	if stale, err := findStale(filepath.Join(dir, "missing"), "", assets); err != nil || len(stale) != 0 {
+		t.Errorf("expected no stale files, got: %v %v", stale, err)
+	}
+}
+
+func TestRemoveEmpty(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base")
+	writeFile(t, filepath.Join(base, "a", "file.mov"), 1)
+	if err := os.MkdirAll(filepath.Join(base, "a", "b", "c"), 0o755); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	removeEmpty(base, filepath.Join(base, "a", "b", "c"))
+	if _, err := os.Stat(filepath.Join(base, "a", "b")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a/b to be removed, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "a", "file.mov")); err != nil {
+		t.Errorf("expected a to be kept, got: %v", err)
+	}
+	// never removes the base directory or directories outside it
+	if err := os.MkdirAll(filepath.Join(dir, "other"), 0o755); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := os.Remove(filepath.Join(base, "a", "file.mov")); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	removeEmpty(base, filepath.Join(base, "a"))
+	removeEmpty(base, filepath.Join(dir, "other"))
+	for _, name := range []string{base, filepath.Join(dir, "other")} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("expected %s to be kept, got: %v", name, err)
+		}
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	from, to := filepath.Join(dir, "from.mov"), filepath.Join(dir, "to.mov")
+	if err := os.WriteFile(from, []byte("data"), 0o600); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(from, mtime, mtime); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// copy, as used across filesystems
+	if err := copyFile(from, to); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	switch fi, err := os.Stat(to); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case fi.Size() != 4, !fi.ModTime().Equal(mtime), fi.Mode().Perm() != 0o600:
+		t.Errorf("expected copy with size 4, mtime %v and mode 0600, got: %d %v %v", mtime, fi.Size(), fi.ModTime(), fi.Mode())
+	}
+	if err := copyFile(from, to); err == nil {
+		t.Errorf("expected error copying over an existing file")
+	}
+	moved := filepath.Join(dir, "moved.mov")
+	if err := moveFile(from, moved); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := os.Stat(from); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected source to be removed, got: %v", err)
+	}
+	if buf, err := os.ReadFile(moved); err != nil || string(buf) != "data" {
+		t.Errorf("expected moved data, got: %q %v", buf, err)
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	dir := t.TempDir()
+	dest, trashDir := filepath.Join(dir, "dest"), filepath.Join(dir, "dest", "trash")
+	writeFile(t, filepath.Join(dest, "Old", "A.mov"), 10)
+	writeFile(t, filepath.Join(dest, "Stray", "B.mov"), 20)
+	writeFile(t, filepath.Join(dest, "C1.mov"), 30)
+	writeFile(t, filepath.Join(dest, "C2.mov"), 30)
+	writeFile(t, filepath.Join(trashDir, "D.mov"), 40)
+	writeFile(t, filepath.Join(dest, "New", "E.mov"), 50)
+	writeFile(t, filepath.Join(dest, "Other", "E.mov"), 50)
+	asset := func(id string, size int, name string) Asset {
+		return Asset{ID: id, URL: "https://example.com/" + id + ".mov", Size: ox.Size(size), Out: filepath.Join(dest, filepath.FromSlash(name))}
+	}
+	entries := &Entries{Assets: []Asset{
+		asset("a", 10, "New/A.mov"),
+		asset("b", 20, "New/B.mov"),
+		asset("c", 30, "New/C.mov"),
+		asset("d", 40, "New/D.mov"),
+		asset("e", 50, "New/E.mov"),
+	}}
+	args := &Args{Trash: trashDir, Quiet: true, logger: t.Logf}
+	args.catalog = entries.Assets
+	args.manifest = &Manifest{Assets: map[string]ManifestAsset{
+		"a": {ID: "a", URL: "https://example.com/a.mov", Size: 10, Path: "Old/A.mov"},
+		"e": {ID: "e", URL: "https://example.com/e.mov", Size: 50, Path: "Other/E.mov"},
+	}}
+	var err error
+	captureStdout(t, func() {
+		err = args.relocate(dest, entries)
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for name, exp := range map[string]bool{
+		"New/A.mov":   true,
+		"Old":         false,
+		"New/B.mov":   true,
+		"Stray":       false,
+		"New/C.mov":   false,
+		"C1.mov":      true,
+		"C2.mov":      true,
+		"New/D.mov":   false,
+		"trash/D.mov": true,
+		"Other/E.mov": true,
+	} {
+		if _, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name))); (err == nil) != exp {
+			t.Errorf("expected %s exists to be %t, got: %v", name, exp, err)
+		}
+	}
+	if p := args.manifest.Assets["a"].Path; p != "New/A.mov" {
+		t.Errorf("expected manifest path New/A.mov, got: %q", p)
+	}
+}
+
+func TestRelocatePlan(t *testing.T) {
+	dest := t.TempDir()
+	writeFile(t, filepath.Join(dest, "Old", "A.mov"), 10)
+	writeFile(t, filepath.Join(dest, "Old", "B.mov"), 20)
+	// a dangling symlink blocking the first rename
+	if err := os.Symlink(filepath.Join(dest, "missing"), filepath.Join(dest, "Blocked")); err != nil {
+		t.Skipf("unable to create symlink: %v", err)
+	}
+	entries := &Entries{Assets: []Asset{
+		{ID: "a", URL: "https://example.com/a.mov", Size: 10, Out: filepath.Join(dest, "Blocked", "A.mov")},
+		{ID: "b", URL: "https://example.com/b.mov", Size: 20, Out: filepath.Join(dest, "New", "B.mov")},
+	}}
+	args := &Args{Quiet: true, logger: t.Logf}
+	args.manifest = &Manifest{Assets: map[string]ManifestAsset{
+		"a": {ID: "a", URL: "https://example.com/a.mov", Size: 10, Path: "Old/A.mov"},
+		"b": {ID: "b", URL: "https://example.com/b.mov", Size: 20, Path: "Old/B.mov"},
+	}}
+	var err error
+	out := captureStdout(t, func() {
+		err = args.relocate(dest, entries)
+	})
+	if err == nil {
+		t.Errorf("expected error")
+	}
+	if _, err := os.Stat(filepath.Join(dest, "Old", "B.mov")); err != nil {
+		t.Errorf("expected Old/B.mov to not be renamed, got: %v", err)
+	}
+	for _, s := range []string{
+		"rename: " + filepath.Join("Old", "A.mov") + " -> " + filepath.Join("Blocked", "A.mov") + "\n",
+		"rename: " + filepath.Join("Old", "B.mov") + " -> " + filepath.Join("New", "B.mov") + "\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected plan to contain %q, got: %q", s, out)
+		}
+	}
+}
+
+func TestCheckManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "Foo.mov"), 10)
+	sum, err := sha256File(filepath.Join(dir, "Foo.mov"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	prev := ManifestAsset{ID: "1", URL: "https://example.com/foo.mov", Size: 10, Path: "Foo.mov", SHA256: sum, Dur: time.Minute}
+	tests := []struct {
+		name   string
+		prev   func(*ManifestAsset)
+		asset  func(*Asset)
+		verify bool
+		ok     bool
+		dl     bool
+	}{
+		{"match", nil, nil, false, true, false},
+		{"not in manifest", func(m *ManifestAsset) { m.ID = "2" }, nil, false, false, false},
+		{"url changed", nil, func(a *Asset) { a.URL = "https://example.com/bar.mov" }, false, false, false},
+		{"size changed", nil, func(a *Asset) { a.Size = 12 }, false, false, false},
+		{"path changed", func(m *ManifestAsset) { m.Path = "Bar.mov" }, nil, false, false, false},
+		{"file missing", func(m *ManifestAsset) { m.Path = "Missing.mov" }, func(a *Asset) { a.Out = filepath.Join(dir, "Missing.mov") }, false, false, false},
+		{"etag changed", func(m *ManifestAsset) { m.ETag = `"old"` }, func(a *Asset) { a.ETag = `"new"` }, false, true, true},
+		{"verify", nil, nil, true, true, false},
+		{"verify mismatch", func(m *ManifestAsset) { m.SHA256 = "bad" }, nil, true, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := prev
+			if test.prev != nil {
+				test.prev(&m)
+			}
+			asset := Asset{ID: "1", URL: "https://example.com/foo.mov", Size: 10, Out: filepath.Join(dir, "Foo.mov")}
+			if test.asset != nil {
+				test.asset(&asset)
+			}
+			args := &Args{Verify: test.verify, Quiet: true, logger: t.Logf}
+			args.manifest = &Manifest{Assets: map[string]ManifestAsset{m.ID: m}}
+			ok, err := args.checkManifest(dir, &asset)
+			switch {
+			case err != nil:
+				t.Fatalf("expected no error, got: %v", err)
+			case ok != test.ok, asset.DL != test.dl:
+				t.Errorf("expected %t/%t, got: %t/%t", test.ok, test.dl, ok, asset.DL)
+			case ok && !asset.DL && (asset.SHA256 != sum || asset.Dur != time.Minute):
+				t.Errorf("expected checksum and duration from manifest, got: %q %v", asset.SHA256, asset.Dur)
+			}
+		})
+	}
+}
+
+func TestCleanParts(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"A.mov.part", "A.mov.part.resume",
+		"B.mov.part", "B.mov.part.resume",
+		"C.mov.part", "C.mov.part.resume",
+		"D.mov.part",
+		"Z.mov.part",
+		"Z.mov",
+	}
+	for _, name := range names {
+		writeFile(t, filepath.Join(dir, name), 1)
+	}
+	asset := func(name string, dl bool, offset int) Asset {
+		return Asset{Name: name, URL: "https://example.com/" + name + ".mov", Out: filepath.Join(dir, name+".mov"), DL: dl, Offset: ox.Size(offset)}
+	}
+	args := &Args{Quiet: true, logger: t.Logf}
+	// A is filtered out, B is resumed, C is restarted, and D is complete
+	args.catalog = []Asset{asset("A", false, 0), asset("B", false, 0), asset("C", false, 0), asset("D", false, 0)}
+	entries := &Entries{Assets: []Asset{asset("B", true, 1), asset("C", true, 0), asset("D", false, 0)}}
+	if err := args.cleanParts(dir, entries); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, name := range names {
+		exp := strings.HasPrefix(name, "A.") || strings.HasPrefix(name, "B.") || name == "Z.mov"
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != exp {
+			t.Errorf("expected %s exists to be %t, got: %v", name, exp, err)
+		}
+	}
+}
+
+// captureStdout captures the standard output written by f.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+	ch := make(chan []byte)
+	go func() {
+		buf, _ := io.ReadAll(r)
+		ch <- buf
+	}()
+	f()
+	_ = w.Close()
+	return string(<-ch)
+}
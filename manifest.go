@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Manifest is the local state of downloaded assets, stored in the destination
+// directory.
+type Manifest struct {
+	Version int                      `json:"version"`
+	Assets  map[string]ManifestAsset `json:"assets"`
+}
+
+// ManifestAsset is the local state of a downloaded asset.
+type ManifestAsset struct {
+	ID           string        `json:"id"`
+	ShotID       string        `json:"shotID"`
+	URL          string        `json:"url"`
+	ETag         string        `json:"etag,omitempty"`
+	LastModified string        `json:"lastModified,omitempty"`
+	Size         int64         `json:"size"`
+	SHA256       string        `json:"sha256,omitempty"`
+	Dur          time.Duration `json:"duration,omitempty"`
+	Media        *MovInfo      `json:"media,omitempty"`
+	MediaErr     string        `json:"mediaError,omitempty"`
+	MediaVersion int           `json:"mediaVersion,omitempty"`
+	Path         string        `json:"path"`
+	Time         time.Time     `json:"time"`
+}
+
+// LoadManifest loads the named manifest, returning an empty manifest when it
+// does not exist.
+func LoadManifest(name string) (*Manifest, error) {
+	m := &Manifest{
+		Version: manifestVersion,
+		Assets:  make(map[string]ManifestAsset),
+	}
+	buf, err := os.ReadFile(name)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return m, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, m); err != nil {
+		return nil, err
+	}
+	if m.Assets == nil {
+		m.Assets = make(map[string]ManifestAsset)
+	}
+	return m, nil
+}
+
+// Save atomically writes the manifest to the named file. The file is removed
+// when the manifest has no assets, so that the destination directory is not
+// required to exist.
+func (m *Manifest) Save(name string) error {
+	if len(m.Assets) == 0 {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(buf, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// sha256File returns the hex encoded sha256 checksum of the named file.
+func sha256File(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// manifest settings.
+const (
+	manifestName    = ".wallgrab.json"
+	manifestVersion = 1
+)
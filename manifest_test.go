@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestSave(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "missing", manifestName)
+	m, err := LoadManifest(name)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// empty manifest in a missing directory
+	if err := m.Save(name); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(name)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected directory to not exist, got: %v", err)
+	}
+	name = filepath.Join(dir, manifestName)
+	m.Assets["1"] = ManifestAsset{ID: "1", ShotID: "A", Size: 10, Path: "Foo.mov"}
+	if err := m.Save(name); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	switch m, err := LoadManifest(name); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case len(m.Assets) != 1 || m.Assets["1"].Path != "Foo.mov":
+		t.Errorf("expected 1 asset, got: %v", m.Assets)
+	}
+	// empty manifest removes the file
+	delete(m.Assets, "1")
+	if err := m.Save(name); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected manifest to be removed, got: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no temporary files, got: %d entries", len(entries))
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// MovInfo is media information parsed from the moov atom of a QuickTime/MP4
+// file.
+type MovInfo struct {
+	Duration time.Duration `json:"duration"`
+	Tracks   []MovTrack    `json:"tracks"`
+}
+
+// Video returns the first video track.
+func (info *MovInfo) Video() (MovTrack, bool) {
+	for _, track := range info.Tracks {
+		if track.Handler == "vide" {
+			return track, true
+		}
+	}
+	return MovTrack{}, false
+}
+
+// String satisfies the [fmt.Stringer] interface.
+func (info *MovInfo) String() string {
+	track, ok := info.Video()
+	if !ok {
+		return info.Duration.String()
+	}
+	return fmt.Sprintf("%s %dx%d %.3gfps %s %s", track.Codec, int(track.Width), int(track.Height), track.FrameRate, track.TransferName(), info.Duration)
+}
+
+// MovTrack is track information parsed from a trak atom.
+type MovTrack struct {
+	ID        uint32        `json:"id"`
+	Handler   string        `json:"handler"`
+	Duration  time.Duration `json:"duration"`
+	Width     float64       `json:"width,omitempty"`
+	Height    float64       `json:"height,omitempty"`
+	Codec     string        `json:"codec,omitempty"`
+	FrameRate float64       `json:"frameRate,omitempty"`
+	Samples   uint64        `json:"samples,omitempty"`
+	Primaries uint16        `json:"primaries,omitempty"`
+	Transfer  uint16        `json:"transfer,omitempty"`
+	Matrix    uint16        `json:"matrix,omitempty"`
+}
+
+// TransferName returns the name of the track's color transfer
+// characteristics.
+func (track MovTrack) TransferName() string {
+	switch track.Transfer {
+	case 0:
+		return "unknown"
+	case 1, 6, 14, 15:
+		return "sdr"
+	case 16:
+		return "pq"
+	case 18:
+		return "hlg"
+	}
+	return fmt.Sprintf("transfer(%d)", track.Transfer)
+}
+
+// HDR returns true when the track has a high dynamic range transfer.
+func (track MovTrack) HDR() bool {
+	return track.Transfer == 16 || track.Transfer == 18
+}
+
+// ReadMov reads the media information from the QuickTime/MP4 file in r of the
+// specified size. Only the top level atom headers and the moov atom are read.
+func ReadMov(r io.ReaderAt, size int64) (*MovInfo, error) {
+	for off := int64(0); off < size; {
+		typ, hdr, n, err := readAtomHeader(r, off, size)
+		if err != nil {
+			return nil, err
+		}
+		if typ == "moov" {
+			if n-hdr > maxMoovSize {
+				return nil, fmt.Errorf("moov atom too large (%d)", n-hdr)
+			}
+			buf := make([]byte, n-hdr)
+			switch i, err := r.ReadAt(buf, off+hdr); {
+			case i < len(buf) && (err == nil || errors.Is(err, io.EOF)):
+				return nil, fmt.Errorf("moov atom truncated: %w", io.ErrUnexpectedEOF)
+			case err != nil && !errors.Is(err, io.EOF):
+				return nil, err
+			}
+			return parseMoov(buf)
+		}
+		off += n
+	}
+	return nil, errors.New("moov atom not found")
+}
+
+// readAtomHeader reads the atom header at off, returning the atom type, the
+// header length, and the total atom length, which must fit within size.
+func readAtomHeader(r io.ReaderAt, off, size int64) (string, int64, int64, error) {
+	var buf [16]byte
+	if _, err := r.ReadAt(buf[:8], off); err != nil {
+		return "", 0, 0, err
+	}
+	n, typ, hdr := int64(binary.BigEndian.Uint32(buf[:4])), string(buf[4:8]), int64(8)
+	switch n {
+	case 0:
+		n = size - off
+	case 1:
+		if _, err := r.ReadAt(buf[8:16], off+8); err != nil {
+			return "", 0, 0, err
+		}
+		n, hdr = int64(binary.BigEndian.Uint64(buf[8:16])), 16
+	}
+	switch {
+	case n < hdr:
+		return "", 0, 0, fmt.Errorf("invalid %q atom size %d at %d", typ, n, off)
+	case n > size-off:
+		// compared against the remaining size, as 64-bit sizes can overflow
+		return "", 0, 0, fmt.Errorf("%q atom size %d at %d exceeds parent", typ, n, off)
+	}
+	return typ, hdr, n, nil
+}
+
+// parseMoov parses the contents of a moov atom.
+func parseMoov(buf []byte) (*MovInfo, error) {
+	info := new(MovInfo)
+	var found bool
+	err := walkAtoms(buf, func(typ string, b []byte) error {
+		switch typ {
+		case "mvhd":
+			timescale, dur, err := parseTimes(b, 12, 20)
+			if err != nil {
+				return fmt.Errorf("mvhd: %w", err)
+			}
+			info.Duration, found = scaleDur(dur, timescale), true
+		case "trak":
+			track, err := parseTrak(b)
+			if err != nil {
+				return fmt.Errorf("trak: %w", err)
+			}
+			info.Tracks = append(info.Tracks, track)
+		}
+		return nil
+	})
+	switch {
+	case err != nil:
+		return nil, err
+	case !found:
+		return nil, errors.New("mvhd atom not found")
+	}
+	return info, nil
+}
+
+// parseTrak parses the contents of a trak atom.
+func parseTrak(buf []byte) (MovTrack, error) {
+	var track MovTrack
+	err := walkAtoms(buf, func(typ string, b []byte) error {
+		switch typ {
+		case "tkhd":
+			// version 0: flags(4) ctime(4) mtime(4) id(4) reserved(4) dur(4)
+			// version 1: flags(4) ctime(8) mtime(8) id(4) reserved(4) dur(8)
+			idOff, end := 12, 84
+			if len(b) > 0 && b[0] == 1 {
+				idOff, end = 20, 96
+			}
+			if len(b) < end {
+				return errors.New("tkhd: short atom")
+			}
+			track.ID = binary.BigEndian.Uint32(b[idOff:])
+			track.Width = float64(binary.BigEndian.Uint32(b[end-8:])) / 65536
+			track.Height = float64(binary.BigEndian.Uint32(b[end-4:])) / 65536
+		case "mdia":
+			return walkAtoms(b, func(typ string, b []byte) error {
+				switch typ {
+				case "mdhd":
+					timescale, dur, err := parseTimes(b, 12, 20)
+					if err != nil {
+						return fmt.Errorf("mdhd: %w", err)
+					}
+					track.Duration = scaleDur(dur, timescale)
+				case "hdlr":
+					// flags(4) pre_defined(4) handler_type(4)
+					if len(b) < 12 {
+						return errors.New("hdlr: short atom")
+					}
+					track.Handler = string(b[8:12])
+				case "minf":
+					return walkAtoms(b, func(typ string, b []byte) error {
+						if typ != "stbl" {
+							return nil
+						}
+						return parseStbl(b, &track)
+					})
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err == nil && track.Samples != 0 && track.Duration > 0 {
+		track.FrameRate = float64(track.Samples) / track.Duration.Seconds()
+	}
+	return track, err
+}
+
+// parseStbl parses the contents of a stbl atom, reading the codec and color
+// information from the first sample description, and the sample count.
+func parseStbl(buf []byte, track *MovTrack) error {
+	return walkAtoms(buf, func(typ string, b []byte) error {
+		switch typ {
+		case "stsd":
+			// flags(4) entry_count(4) entries...
+			if len(b) < 8 {
+				return errors.New("stsd: short atom")
+			}
+			var first bool
+			return walkAtoms(b[8:], func(typ string, b []byte) error {
+				if first {
+					return nil
+				}
+				track.Codec, first = typ, true
+				// visual sample entries have 78 bytes of fields before child
+				// atoms
+				if track.Handler != "vide" || len(b) < 78 {
+					return nil
+				}
+				return walkAtoms(b[78:], func(typ string, b []byte) error {
+					// colour_type(4) primaries(2) transfer(2) matrix(2)
+					if typ != "colr" || len(b) < 10 {
+						return nil
+					}
+					if s := string(b[:4]); s != "nclx" && s != "nclc" {
+						return nil
+					}
+					track.Primaries = binary.BigEndian.Uint16(b[4:])
+					track.Transfer = binary.BigEndian.Uint16(b[6:])
+					track.Matrix = binary.BigEndian.Uint16(b[8:])
+					return nil
+				})
+			})
+		case "stts":
+			// flags(4) entry_count(4) (sample_count(4) sample_delta(4))...
+			if len(b) < 8 {
+				return errors.New("stts: short atom")
+			}
+			n := int(binary.BigEndian.Uint32(b[4:]))
+			for i := 0; i < n && 16+8*i <= len(b); i++ {
+				track.Samples += uint64(binary.BigEndian.Uint32(b[8+8*i:]))
+			}
+		}
+		return nil
+	})
+}
+
+// parseTimes parses the timescale and duration from a version 0 or 1 header
+// atom (mvhd, mdhd), where v0 and v1 are the offsets of the timescale.
+func parseTimes(b []byte, v0, v1 int) (uint32, uint64, error) {
+	if len(b) < 1 {
+		return 0, 0, errors.New("short atom")
+	}
+	if b[0] == 1 {
+		if len(b) < v1+12 {
+			return 0, 0, errors.New("short atom")
+		}
+		return binary.BigEndian.Uint32(b[v1:]), binary.BigEndian.Uint64(b[v1+4:]), nil
+	}
+	if len(b) < v0+8 {
+		return 0, 0, errors.New("short atom")
+	}
+	return binary.BigEndian.Uint32(b[v0:]), uint64(binary.BigEndian.Uint32(b[v0+4:])), nil
+}
+
+// walkAtoms calls f with the type and contents of each atom in buf.
+func walkAtoms(buf []byte, f func(string, []byte) error) error {
+	r := bytes.NewReader(buf)
+	size := int64(len(buf))
+	for off := int64(0); off < size; {
+		typ, hdr, n, err := readAtomHeader(r, off, size)
+		if err != nil {
+			return err
+		}
+		if err := f(typ, buf[off+hdr:off+n]); err != nil {
+			return err
+		}
+		off += n
+	}
+	return nil
+}
+
+// scaleDur converts a duration in timescale units to a [time.Duration].
+func scaleDur(dur uint64, timescale uint32) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+	return time.Duration(float64(dur) / float64(timescale) * float64(time.Second))
+}
+
+// maxMoovSize is the maximum moov atom size to read.
+const maxMoovSize = 64 << 20
+
+// movVersion is the version of the media parser, incremented when parsing
+// changes so that previously recorded failures are retried.
+const movVersion = 1
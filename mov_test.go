@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestReadMov(t *testing.T) {
+	video := trak(1, 1920, 1080, "vide", 600, 600*30, "hvc1", 16, 1800)
+	audio := trak(2, 0, 0, "soun", 48000, 48000*30, "mp4a", 0, 1400)
+	tests := []struct {
+		name string
+		buf  []byte
+		dur  time.Duration
+		exp  string
+	}{
+		{
+			"v0",
+			cat(atom("ftyp", []byte("qt  ")), atom("mdat", make([]byte, 32)), atom("moov", mvhd(0, 600, 600*30), video, audio)),
+			30 * time.Second,
+			"hvc1 1920x1080 60fps pq 30s",
+		},
+		{
+			"v1",
+			cat(atom("ftyp", []byte("qt  ")), atom("moov", mvhd(1, 1000, 1000*90), video)),
+			90 * time.Second,
+			"hvc1 1920x1080 60fps pq 1m30s",
+		},
+		{
+			"64-bit mdat",
+			cat(atom("ftyp", []byte("qt  ")), atom64("mdat", make([]byte, 64)), atom("moov", mvhd(0, 600, 600*15))),
+			15 * time.Second,
+			"15s",
+		},
+		{
+			"mdat to end",
+			cat(atom("moov", mvhd(0, 600, 600*10), audio), atom0("mdat", make([]byte, 16))),
+			10 * time.Second,
+			"10s",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := ReadMov(bytes.NewReader(test.buf), int64(len(test.buf)))
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if info.Duration != test.dur {
+				t.Errorf("expected duration %v, got: %v", test.dur, info.Duration)
+			}
+			if s := info.String(); s != test.exp {
+				t.Errorf("expected %q, got: %q", test.exp, s)
+			}
+		})
+	}
+}
+
+func TestReadMovTracks(t *testing.T) {
+	buf := atom("moov",
+		mvhd(0, 600, 600*30),
+		trak(1, 3840, 2160, "vide", 600, 600*30, "hvc1", 18, 7200),
+		trak(2, 0, 0, "soun", 48000, 48000*30, "mp4a", 0, 1400),
+	)
+	info, err := ReadMov(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(info.Tracks) != 2 {
+		t.Fatalf("expected 2 tracks, got: %d", len(info.Tracks))
+	}
+	video, ok := info.Video()
+	switch {
+	case !ok:
+		t.Fatalf("expected video track")
+	case video.ID != 1, video.Width != 3840, video.Height != 2160, video.Codec != "hvc1":
+		t.Errorf("unexpected video track: %+v", video)
+	case video.FrameRate != 240, video.Samples != 7200, video.Duration != 30*time.Second:
+		t.Errorf("unexpected video timing: %+v", video)
+	case video.Primaries != 9, video.Transfer != 18, video.Matrix != 9, !video.HDR(), video.TransferName() != "hlg":
+		t.Errorf("unexpected video color: %+v", video)
+	}
+	if audio := info.Tracks[1]; audio.Handler != "soun" || audio.Codec != "mp4a" || audio.Transfer != 0 || audio.Duration != 30*time.Second {
+		t.Errorf("unexpected audio track: %+v", audio)
+	}
+}
+
+func TestReadMovErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"no moov", cat(atom("ftyp", []byte("qt  ")), atom("mdat", make([]byte, 8)))},
+		{"no mvhd", atom("moov", atom("udta", nil))},
+		{"short header", []byte{0, 0, 0}},
+		{"invalid size", cat([]byte{0, 0, 0, 4}, []byte("moov"))},
+		{"exceeds parent", atom("moov", cat([]byte{0, 0, 0, 64}, []byte("mvhd")))},
+		{"short mvhd", atom("moov", atom("mvhd", make([]byte, 8)))},
+		{"short v1 mvhd", atom("moov", atom("mvhd", append([]byte{1}, make([]byte, 20)...)))},
+		{"truncated moov", atom("moov", mvhd(0, 600, 600))[:20]},
+		{"64-bit overflow", atom("moov", mvhd(0, 600, 600), cat(be32(1), []byte("udta"), be64(0x7FFFFFFFFFFFFFF0)))},
+		{"64-bit top level overflow", cat(atom("ftyp", []byte("qt  ")), be32(1), []byte("mdat"), be64(0x7FFFFFFFFFFFFFF0), atom("moov", mvhd(0, 600, 600)))},
+		{"64-bit negative", cat(be32(1), []byte("mdat"), be64(0xFFFFFFFFFFFFFFF0))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ReadMov(bytes.NewReader(test.buf), int64(len(test.buf))); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+	// size larger than the available data
+	buf := atom("moov", mvhd(0, 600, 600))
+	if _, err := ReadMov(bytes.NewReader(buf[:len(buf)-8]), int64(len(buf))); err == nil {
+		t.Errorf("expected error for short read")
+	}
+}
+
+func TestScaleDur(t *testing.T) {
+	tests := []struct {
+		dur       uint64
+		timescale uint32
+		exp       time.Duration
+	}{
+		{0, 0, 0},
+		{100, 0, 0},
+		{600, 600, time.Second},
+		{1, 1000, time.Millisecond},
+		{90000 * 60, 90000, time.Minute},
+	}
+	for _, test := range tests {
+		if d := scaleDur(test.dur, test.timescale); d != test.exp {
+			t.Errorf("scaleDur(%d, %d) expected %v, got: %v", test.dur, test.timescale, test.exp, d)
+		}
+	}
+}
+
+// cat concatenates the byte slices.
+func cat(v ...[]byte) []byte {
+	return bytes.Join(v, nil)
+}
+
+// atom builds an atom with a 32-bit size.
+func atom(typ string, body ...[]byte) []byte {
+	b := cat(body...)
+	return cat(be32(uint32(8+len(b))), []byte(typ), b)
+}
+
+// atom64 builds an atom with a 64-bit size.
+func atom64(typ string, body ...[]byte) []byte {
+	b := cat(body...)
+	return cat(be32(1), []byte(typ), be64(uint64(16+len(b))), b)
+}
+
+// atom0 builds an atom with a 0 size, that extends to the end of the file.
+func atom0(typ string, body ...[]byte) []byte {
+	return cat(be32(0), []byte(typ), cat(body...))
+}
+
+// mvhd builds a mvhd atom.
+func mvhd(version byte, timescale uint32, dur uint64) []byte {
+	if version == 1 {
+		// flags(4) ctime(8) mtime(8) timescale(4) dur(8)
+		return atom("mvhd", []byte{1, 0, 0, 0}, make([]byte, 16), be32(timescale), be64(dur), make([]byte, 80))
+	}
+	// flags(4) ctime(4) mtime(4) timescale(4) dur(4)
+	return atom("mvhd", []byte{0, 0, 0, 0}, make([]byte, 8), be32(timescale), be32(uint32(dur)), make([]byte, 80))
+}
+
+// trak builds a trak atom.
+func trak(id uint32, width, height uint32, handler string, timescale uint32, dur uint64, codec string, transfer uint16, samples uint32) []byte {
+	// flags(4) ctime(4) mtime(4) id(4) reserved(4) dur(4) ... width(4) height(4)
+	tkhd := atom("tkhd", make([]byte, 12), be32(id), make([]byte, 60), be32(width<<16), be32(height<<16))
+	mdhd := atom("mdhd", make([]byte, 12), be32(timescale), be32(uint32(dur)), make([]byte, 4))
+	hdlr := atom("hdlr", make([]byte, 8), []byte(handler), make([]byte, 12))
+	var entry []byte
+	if handler == "vide" {
+		colr := atom("colr", []byte("nclx"), be16(9), be16(transfer), be16(9), []byte{0})
+		entry = atom(codec, make([]byte, 78), colr)
+	} else {
+		entry = atom(codec, make([]byte, 28))
+	}
+	stsd := atom("stsd", make([]byte, 4), be32(1), entry)
+	stts := atom("stts", make([]byte, 4), be32(1), be32(samples), be32(1))
+	return atom("trak", tkhd, atom("mdia", mdhd, hdlr, atom("minf", atom("stbl", stsd, stts))))
+}
+
+func be16(i uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, i)
+}
+
+func be32(i uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, i)
+}
+
+func be64(i uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, i)
+}
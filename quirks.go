@@ -0,0 +1,96 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"maps"
+	"os"
+	"path"
+	"slices"
+)
+
+// Quirks are fixups for entries.json, keyed by macOS version. Keys may be
+// globs (ie, "v26.*").
+type Quirks map[string]Quirk
+
+// LoadQuirks loads the embedded quirks, overridden by the quirks in the
+// named file, when not empty. Quirks in the file replace the embedded quirks
+// for the same version.
+func LoadQuirks(name string) (Quirks, error) {
+	quirks := make(Quirks)
+	if err := json.Unmarshal(quirksJSON, &quirks); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return quirks, nil
+	}
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var m Quirks
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, err
+	}
+	maps.Copy(quirks, m)
+	return quirks, nil
+}
+
+// Get returns the quirk for the version, combining the rules of all matching
+// keys, exact matches first.
+func (quirks Quirks) Get(version string) Quirk {
+	quirk := quirks[version]
+	for _, k := range slices.Sorted(maps.Keys(quirks)) {
+		if ok, _ := path.Match(k, version); ok && k != version {
+			quirk.Categories = append(quirk.Categories, quirks[k].Categories...)
+			quirk.Subcategories = append(quirk.Subcategories, quirks[k].Subcategories...)
+		}
+	}
+	return quirk
+}
+
+// Quirk are the category and subcategory fixups for a macOS version.
+type Quirk struct {
+	Categories    []QuirkRule `json:"categories,omitempty"`
+	Subcategories []QuirkRule `json:"subcategories,omitempty"`
+}
+
+// Category applies the first matching category rule to the id, returning
+// the (possibly remapped) id and the localized name key override, if any.
+func (quirk Quirk) Category(id string) (string, string) {
+	return applyRules(quirk.Categories, id)
+}
+
+// Subcategory applies the first matching subcategory rule to the id,
+// returning the (possibly remapped) id and the localized name key override,
+// if any.
+func (quirk Quirk) Subcategory(id string) (string, string) {
+	return applyRules(quirk.Subcategories, id)
+}
+
+// QuirkRule remaps an id matching a glob to another id, or overrides its
+// localized name key.
+type QuirkRule struct {
+	Match string `json:"match"`
+	ID    string `json:"id,omitempty"`
+	Key   string `json:"key,omitempty"`
+}
+
+// applyRules applies the first matching rule to the id.
+func applyRules(rules []QuirkRule, id string) (string, string) {
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.Match, id); ok {
+			if rule.ID != "" {
+				id = rule.ID
+			}
+			return id, rule.Key
+		}
+	}
+	return id, ""
+}
+
+// quirksFile is the name of the user quirks file in the config directory.
+const quirksFile = "quirks.json"
+
+//go:embed quirks.json
+var quirksJSON []byte
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestQuirksGet(t *testing.T) {
+	quirks := Quirks{
+		"v26.0": {
+			Categories: []QuirkRule{{Match: "a", ID: "exact"}},
+		},
+		"v26.*": {
+			Categories:    []QuirkRule{{Match: "a", ID: "glob"}, {Match: "b", ID: "glob"}},
+			Subcategories: []QuirkRule{{Match: "c", Key: "glob"}},
+		},
+		"v2?.*": {
+			Categories: []QuirkRule{{Match: "*", ID: "any"}},
+		},
+		"v15.*": {
+			Categories: []QuirkRule{{Match: "*", ID: "old"}},
+		},
+	}
+	tests := []struct {
+		version       string
+		categories    []string
+		subcategories []string
+	}{
+		{"v26.0", []string{"exact", "glob", "glob", "any"}, []string{"glob"}},
+		{"v26.1", []string{"glob", "glob", "any"}, []string{"glob"}},
+		{"v27.0", []string{"any"}, nil},
+		{"v15.2", []string{"old"}, nil},
+		{"v14.0", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			quirk := quirks.Get(test.version)
+			if v := ruleValues(quirk.Categories, false); !slices.Equal(v, test.categories) {
+				t.Errorf("expected categories %v, got: %v", test.categories, v)
+			}
+			if v := ruleValues(quirk.Subcategories, true); !slices.Equal(v, test.subcategories) {
+				t.Errorf("expected subcategories %v, got: %v", test.subcategories, v)
+			}
+		})
+	}
+	if n := len(quirks["v26.0"].Categories); n != 1 {
+		t.Errorf("expected Get to not modify quirks, got: %d rules", n)
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	rules := []QuirkRule{
+		{Match: "A33A55D9-*", ID: "A33A55D9-FULL"},
+		{Match: "0DC99DD8", Key: "AerialSubcategoryTahoe"},
+		{Match: "B*", ID: "B-ID", Key: "B-KEY"},
+		{Match: "BB", ID: "unreachable"},
+	}
+	tests := []struct {
+		id    string
+		expID string
+		key   string
+	}{
+		{"A33A55D9-EDEA", "A33A55D9-FULL", ""},
+		{"0DC99DD8", "0DC99DD8", "AerialSubcategoryTahoe"},
+		{"BB", "B-ID", "B-KEY"},
+		{"C", "C", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			id, key := applyRules(rules, test.id)
+			if id != test.expID || key != test.key {
+				t.Errorf("expected %q/%q, got: %q/%q", test.expID, test.key, id, key)
+			}
+		})
+	}
+}
+
+func TestLoadQuirks(t *testing.T) {
+	embedded, err := LoadQuirks("")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(embedded) == 0 {
+		t.Fatalf("expected embedded quirks")
+	}
+	dir := t.TempDir()
+	override := filepath.Join(dir, quirksFile)
+	if err := os.WriteFile(override, []byte(`{
+  "v26.0": {"categories": [{"match": "x", "id": "y"}]},
+  "v99.*": {"subcategories": [{"match": "z", "key": "k"}]}
+}`), 0o644); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	quirks, err := LoadQuirks(override)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(quirks) != len(embedded)+1 {
+		t.Errorf("expected %d quirks, got: %d", len(embedded)+1, len(quirks))
+	}
+	switch quirk := quirks["v26.0"]; {
+	case len(quirk.Categories) != 1 || quirk.Categories[0].ID != "y":
+		t.Errorf("expected v26.0 categories to be replaced, got: %v", quirk.Categories)
+	case len(quirk.Subcategories) != 0:
+		t.Errorf("expected v26.0 subcategories to be replaced, got: %v", quirk.Subcategories)
+	}
+	if id, key := quirks.Get("v99.1").Subcategory("z"); id != "z" || key != "k" {
+		t.Errorf("expected z/k, got: %s/%s", id, key)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"v26.0": []}`), 0o644); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, name := range []string{invalid, filepath.Join(dir, "missing.json")} {
+		if _, err := LoadQuirks(name); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+}
+
+// ruleValues returns the ids (or keys) of the rules.
+func ruleValues(rules []QuirkRule, key bool) []string {
+	var v []string
+	for _, rule := range rules {
+		if key {
+			v = append(v, rule.Key)
+		} else {
+			v = append(v, rule.ID)
+		}
+	}
+	return v
+}